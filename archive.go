@@ -0,0 +1,127 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/daviddengcn/go-colortext"
+	"github.com/deild/td/db"
+)
+
+// Archive moves todos removed from the list to the archive of the store. It
+// must be called before WriteTodos, while the store is locked.
+func (c *Collection) Archive(todos []*Todo) error {
+	if len(todos) == 0 {
+		return nil
+	}
+	store, err := c.openStore()
+	if err != nil {
+		return err
+	}
+
+	now := c.now()
+	records := make([]json.RawMessage, len(todos))
+	for i, todo := range todos {
+		c.record(todo, now, EventArchived, "", "")
+		if records[i], err = json.Marshal(todo); err != nil {
+			return err
+		}
+	}
+	if err = db.Archive(store, records); err != nil {
+		return err
+	}
+	c.archived = append(c.archived, records...)
+	return nil
+}
+
+// Archived returns the todos of the archive, from the oldest
+func (c *Collection) Archived() ([]*Todo, error) {
+	store, err := c.openStore()
+	if err != nil {
+		return nil, err
+	}
+	records, err := db.LoadArchive(store)
+	if err != nil {
+		return nil, err
+	}
+	return decodeTodos(records)
+}
+
+// Restore takes back a todo from the archive, designated by its UID or a
+// prefix of it. The todo gets a new ID, at the end of the list, and loses
+// its parent and its dependencies, whose IDs are no longer valid. The todo
+// leaves the archive when the collection is written.
+func (c *Collection) Restore(ref string) (*Todo, error) {
+	archived, err := c.Archived()
+	if err != nil {
+		return nil, err
+	}
+
+	ref = strings.ToLower(strings.TrimSpace(ref))
+	var matches []*Todo
+	if len(ref) >= minUIDPrefix {
+		for _, todo := range archived {
+			if strings.HasPrefix(todo.UID, ref) {
+				matches = append(matches, todo)
+			}
+		}
+	}
+	switch len(matches) {
+	case 0:
+		return nil, fmt.Errorf("The archived todo with the UID %s was not found.", ref)
+	case 1:
+	default:
+		return nil, fmt.Errorf("The UID %s is ambiguous, it starts %d archived todos.", ref, len(matches))
+	}
+
+	todo := matches[0]
+	record, err := json.Marshal(todo)
+	if err != nil {
+		return nil, err
+	}
+	// removed from the archive by WriteTodos, once the list is written
+	c.restored = append(c.restored, record)
+
+	var highestID int64
+	for _, other := range c.Todos {
+		if other.ID > highestID {
+			highestID = other.ID
+		}
+	}
+	todo.ID = highestID + 1
+	todo.Parent = 0
+	todo.DependsOn = nil
+	now := c.now()
+	c.record(todo, now, EventRestored, "", "")
+	todo.Modified = now
+	c.Todos = append(c.Todos, todo)
+
+	return todo, nil
+}
+
+// MakeArchivedOutput print an archived todo, designated by the start of its
+// UID, with its completion date
+func (t *Todo) MakeArchivedOutput(useColor bool) {
+	uid := t.UID
+	if len(uid) > 8 {
+		uid = uid[:8]
+	}
+	fmt.Print(uid, " | ")
+
+	status := statusOf(t.Status)
+	symbole := status.Symbol
+	color := status.Color
+	if useColor {
+		ct.ChangeColor(color, false, ct.None, false)
+	}
+	fmt.Print(symbole)
+	if useColor {
+		ct.ResetColor()
+	}
+	fmt.Print(" ", t.Desc)
+	if !t.Completed.IsZero() {
+		fmt.Print(" (done ", t.Completed.Local().Format(dateLayout), ")")
+	}
+	fmt.Println()
+}
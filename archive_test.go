@@ -0,0 +1,116 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/deild/td/db"
+)
+
+// archivedCollection returns a collection of a memory store where "Write" is
+// done a month ago, "Test" done yesterday and "Deploy" pending
+func archivedCollection(t *testing.T) (*db.MemStore, *Collection) {
+	store := db.NewMemStore(t.Name())
+	store.Initialize()
+
+	collection, err := NewCollectionFromStore(store)
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := time.Now()
+	for _, desc := range []string{"Write", "Test", "Deploy"} {
+		task := NewTodo()
+		task.Desc = desc
+		collection.CreateTodo(task)
+	}
+	collection.Todos[0].Status = DONE
+	collection.Todos[0].Completed = now.AddDate(0, -1, 0)
+	collection.Todos[1].Status = DONE
+	collection.Todos[1].Completed = now.AddDate(0, 0, -1)
+	if err := collection.WriteTodos(); err != nil {
+		t.Fatal(err)
+	}
+	return store, collection
+}
+
+func TestArchiveOlderThan(t *testing.T) {
+	store, collection := archivedCollection(t)
+	before, _ := ParseSince("7d", time.Now())
+	removed := collection.RemoveTodosDoneBefore(before)
+	if err := collection.Archive(removed); err != nil {
+		t.Fatal(err)
+	}
+	collection.WriteTodos()
+
+	collection, _ = NewCollectionFromStore(store)
+	defer collection.Close()
+	if len(collection.Todos) != 2 || collection.Todos[0].Desc != "Test" {
+		t.Fatalf("Expected only \"Write\" to be removed, got %d todos", len(collection.Todos))
+	}
+	archived, err := collection.Archived()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(archived) != 1 || archived[0].Desc != "Write" || archived[0].Completed.IsZero() {
+		t.Fatalf("Expected \"Write\" to be archived with its completion date, got %d todos", len(archived))
+	}
+	if history := actions(archived[0]); history[len(history)-1] != EventArchived {
+		t.Errorf("Expected the archiving in the history, got %q", history)
+	}
+}
+
+func TestArchiveRestore(t *testing.T) {
+	store, collection := archivedCollection(t)
+	collection.Archive(collection.RemoveFinishedTodos())
+	collection.WriteTodos()
+
+	collection, _ = NewCollectionFromStore(store)
+	archived, _ := collection.Archived()
+	if len(archived) != 2 {
+		t.Fatalf("Expected 2 archived todos, got %d", len(archived))
+	}
+	if _, err := collection.Restore("zzzz"); err == nil {
+		t.Error("Expected an unknown UID to be refused")
+	}
+	todo, err := collection.Restore(archived[1].UID[:6])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if todo.Desc != "Test" || todo.ID != 4 {
+		t.Errorf("Expected \"Test\" to be back with the id 4, got #%d %s", todo.ID, todo.Desc)
+	}
+	if archived, _ = collection.Archived(); len(archived) != 2 {
+		t.Errorf("Expected the todo to stay in the archive until the list is written, got %d todos", len(archived))
+	}
+	collection.WriteTodos()
+
+	collection, _ = NewCollectionFromStore(store)
+	defer collection.Close()
+	if len(collection.Todos) != 2 {
+		t.Errorf("Expected 2 todos in the list, got %d", len(collection.Todos))
+	}
+	if archived, _ = collection.Archived(); len(archived) != 1 || archived[0].Desc != "Write" {
+		t.Errorf("Expected only \"Write\" left in the archive, got %d todos", len(archived))
+	}
+}
+
+func TestUndoClean(t *testing.T) {
+	store, collection := archivedCollection(t)
+	collection.Command = "td clean"
+	collection.Archive(collection.RemoveFinishedTodos())
+	collection.WriteTodos()
+
+	journal, _ := db.OpenJournal(store)
+	if _, err := journal.Undo(store); err != nil {
+		t.Fatal(err)
+	}
+
+	collection, _ = NewCollectionFromStore(store)
+	defer collection.Close()
+	if len(collection.Todos) != 3 {
+		t.Errorf("Expected the 3 todos back in the list, got %d", len(collection.Todos))
+	}
+	if archived, _ := collection.Archived(); len(archived) != 0 {
+		t.Errorf("Expected the archive to be emptied, got %d todos", len(archived))
+	}
+}
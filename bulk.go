@@ -0,0 +1,186 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+)
+
+// Select returns the IDs of the todos a command changes: the ones designated
+// by refs, see ResolveAll, or else the ones matching the query where, like td
+// list does: the finished todos only when the query is about the status
+func (c *Collection) Select(refs []string, where string) ([]int64, error) {
+	if where == "" {
+		if len(refs) == 0 {
+			return nil, errors.New("You must provide the ids of the todos, or --where.")
+		}
+		return c.ResolveAll(refs)
+	}
+	if len(refs) > 0 {
+		return nil, errors.New("You must provide either the ids of the todos or --where, not both.")
+	}
+
+	query, err := ParseQuery(where, time.Now())
+	if err != nil {
+		return nil, queryError(err)
+	}
+	todos, err := c.Matching(query, false)
+	if err != nil {
+		return nil, err
+	}
+	if !aboutStatus(query) {
+		var unfinished []*Todo
+		for _, todo := range todos {
+			if !todo.IsFinished() {
+				unfinished = append(unfinished, todo)
+			}
+		}
+		todos = unfinished
+	}
+	if len(todos) == 0 {
+		return nil, fmt.Errorf("There's no todo matching \"%s\".", where)
+	}
+	ids := make([]int64, len(todos))
+	for i, todo := range todos {
+		ids[i] = todo.ID
+	}
+	return ids, nil
+}
+
+// ToggleAll toggles the status of todos, each one from its status before the
+// others were changed: marking a parent as done doesn't make its subtasks
+// toggle back to pending. The subtasks are toggled before their parent, so a
+// parent finished finishes them whatever their toggle.
+func (c *Collection) ToggleAll(ids []int64) ([]*Todo, error) {
+	statuses := make([]string, len(ids))
+	depths := make([]int, len(ids))
+	for i, id := range ids {
+		todo, err := c.Find(id)
+		if err != nil {
+			return nil, err
+		}
+		statuses[i] = nextStatus(todo.Status)
+		depths[i] = c.depth(todo)
+	}
+
+	order := make([]int, len(ids))
+	for i := range order {
+		order[i] = i
+	}
+	sort.SliceStable(order, func(i, j int) bool { return depths[order[i]] > depths[order[j]] })
+
+	todos := make([]*Todo, len(ids))
+	for _, i := range order {
+		todo, err := c.SetStatus(ids[i], statuses[i])
+		if err != nil {
+			return nil, err
+		}
+		todos[i] = todo
+	}
+	return todos, nil
+}
+
+// depth returns the number of ancestors of a todo
+func (c *Collection) depth(todo *Todo) int {
+	depth := 0
+	seen := map[int64]bool{todo.ID: true}
+	for parent := todo.Parent; parent != 0 && !seen[parent]; depth++ {
+		seen[parent] = true
+		ancestor, err := c.Find(parent)
+		if err != nil {
+			break
+		}
+		parent = ancestor.Parent
+	}
+	return depth
+}
+
+// SetStatusAll sets the status of todos
+func (c *Collection) SetStatusAll(ids []int64, status string) ([]*Todo, error) {
+	todos := make([]*Todo, len(ids))
+	for i, id := range ids {
+		todo, err := c.SetStatus(id, status)
+		if err != nil {
+			return nil, err
+		}
+		todos[i] = todo
+	}
+	return todos, nil
+}
+
+// Remove deletes todos, which are returned. Their subtasks are moved to the
+// top of the list, and the todos they blocked no longer wait for them.
+func (c *Collection) Remove(ids []int64) ([]*Todo, error) {
+	removed := map[int64]bool{}
+	for _, id := range ids {
+		if _, err := c.Find(id); err != nil {
+			return nil, err
+		}
+		removed[id] = true
+	}
+
+	old := c.ids()
+	var todos []*Todo
+	for i := len(c.Todos) - 1; i >= 0; i-- {
+		if removed[c.Todos[i].ID] {
+			todos = append([]*Todo{c.Todos[i]}, todos...)
+			c.RemoveAtIndex(i)
+		}
+	}
+
+	parents := map[*Todo]int64{}
+	dependencies := map[*Todo][]int64{}
+	for _, todo := range c.Todos {
+		parents[todo], dependencies[todo] = todo.Parent, todo.DependsOn
+	}
+	c.renumbered(old)
+
+	now := c.now()
+	for _, todo := range c.Todos {
+		if len(todo.DependsOn) != len(dependencies[todo]) {
+			c.record(todo, now, EventDepends, joinIDs(dependencies[todo]), joinIDs(todo.DependsOn))
+			todo.Modified = now
+		}
+		if todo.Parent != parents[todo] {
+			todo.Modified = now
+		}
+	}
+	return todos, nil
+}
+
+// MarkDone marks todos as done, see doneStatus. The ones already finished are
+// left as they are, and returned apart.
+func (c *Collection) MarkDone(ids []int64) (marked []*Todo, already []*Todo, err error) {
+	return c.markAll(ids, doneStatus(), (*Todo).IsFinished)
+}
+
+// MarkPending marks todos as pending, the first status. The ones already
+// pending are left as they are, and returned apart.
+func (c *Collection) MarkPending(ids []int64) (marked []*Todo, already []*Todo, err error) {
+	return c.markAll(ids, initialStatus(), func(t *Todo) bool { return t.Status == initialStatus() })
+}
+
+// markAll sets the status of the todos which are not already in it, before
+// any of them is changed
+func (c *Collection) markAll(ids []int64, status string, already func(t *Todo) bool) ([]*Todo, []*Todo, error) {
+	var targets, unchanged []*Todo
+	for _, id := range ids {
+		todo, err := c.Find(id)
+		if err != nil {
+			return nil, nil, err
+		}
+		if already(todo) {
+			unchanged = append(unchanged, todo)
+		} else {
+			targets = append(targets, todo)
+		}
+	}
+
+	for _, todo := range targets {
+		if _, err := c.SetStatus(todo.ID, status); err != nil {
+			return nil, nil, err
+		}
+	}
+	return targets, unchanged, nil
+}
@@ -0,0 +1,187 @@
+package main
+
+import (
+	"testing"
+)
+
+func TestResolveRanges(t *testing.T) {
+	collection, _ := collectionFromTaskDesk([]string{"a", "b", "c", "d", "e", "f"})
+	collection.RemoveAtIndex(3)
+
+	tests := []struct {
+		refs     []string
+		expected string
+	}{
+		{[]string{"3", "5"}, "3, 5"},
+		{[]string{"2-5"}, "2, 3, 5"},
+		{[]string{"5", "1-3", "3"}, "5, 1, 2, 3"},
+		{[]string{"6-6"}, "6"},
+	}
+	for _, test := range tests {
+		ids, err := collection.ResolveAll(test.refs)
+		if err != nil {
+			t.Errorf("%v: %s", test.refs, err)
+			continue
+		}
+		if joinIDs(ids) != test.expected {
+			t.Errorf("%v: expected the todos %s, got %s", test.refs, test.expected, joinIDs(ids))
+		}
+	}
+
+	for _, refs := range [][]string{{"5-2"}, {"4-4"}, {"7-9"}} {
+		if _, err := collection.ResolveAll(refs); err == nil {
+			t.Errorf("%v: expected the range to be refused", refs)
+		}
+	}
+}
+
+func TestSelect(t *testing.T) {
+	collection := queryCollection()
+	ids, err := collection.Select(nil, "tag:api")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if joinIDs(ids) != "1, 3" {
+		t.Errorf("Expected the todos 1 and 3, got %s", joinIDs(ids))
+	}
+
+	// 4 is done, like td list it is selected only by a query about the status
+	if ids, _ := collection.Select(nil, "mum"); len(ids) != 0 {
+		t.Errorf("Expected a finished todo not to be selected, got %s", joinIDs(ids))
+	}
+	if ids, _ := collection.Select(nil, "mum is:finished"); joinIDs(ids) != "4" {
+		t.Errorf("Expected the finished todo 4 to be selected, got %s", joinIDs(ids))
+	}
+
+	if _, err := collection.Select(nil, ""); err == nil {
+		t.Error("Expected no ids and no query to fail")
+	}
+	if _, err := collection.Select([]string{"1"}, "tag:api"); err == nil {
+		t.Error("Expected ids and a query to fail")
+	}
+	if _, err := collection.Select(nil, "tag:nothing"); err == nil {
+		t.Error("Expected a query matching nothing to fail")
+	}
+	if _, err := collection.Select(nil, "tag:"); err == nil {
+		t.Error("Expected an invalid query to fail")
+	}
+}
+
+func TestToggleAll(t *testing.T) {
+	collection := subtaskCollection()
+	collection.SetStatus(1, WIP)
+	collection.SetStatus(4, DONE)
+
+	// 4 becomes pending, then 1 marks its subtasks as done
+	todos, err := collection.ToggleAll([]int64{1, 4, 5})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(todos) != 3 || todos[0].ID != 1 || todos[1].ID != 4 || todos[2].ID != 5 {
+		t.Fatalf("Expected the todos in the order given, got %+v", todos)
+	}
+	for _, todo := range collection.Todos[:4] {
+		if todo.Status != DONE {
+			t.Errorf("Expected the todo %d to be done with its parent, got %s", todo.ID, todo.Status)
+		}
+	}
+	if todos[2].Status != WIP {
+		t.Errorf("Expected the todo 5 to be in progress, got %s", todos[2].Status)
+	}
+
+	// a subtask toggled with its parent doesn't leave it finished
+	collection = subtaskCollection()
+	collection.SetStatus(1, WIP)
+	if _, err := collection.ToggleAll([]int64{1, 2}); err != nil {
+		t.Fatal(err)
+	}
+	if collection.Todos[0].Status != DONE || collection.Todos[1].Status != DONE {
+		t.Errorf("Expected the todo 1 and its subtask 2 to be done, got %s and %s", collection.Todos[0].Status, collection.Todos[1].Status)
+	}
+
+	if _, err := collection.ToggleAll([]int64{5, 9}); err == nil {
+		t.Error("Expected a missing todo to fail")
+	}
+	if collection.Todos[4].Status != PENDING {
+		t.Error("Expected nothing to change when a todo is missing")
+	}
+}
+
+func TestRemove(t *testing.T) {
+	collection := subtaskCollection()
+	collection.Now = fixedClock()
+	collection.Block(5, []int64{2, 4})
+
+	todos, err := collection.Remove([]int64{3, 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(todos) != 2 || todos[0].Desc != "Write changelog" || todos[1].Desc != "Build" {
+		t.Fatalf("Expected the todos 2 and 3 to be removed, got %+v", todos)
+	}
+	if len(collection.Todos) != 3 {
+		t.Fatalf("Expected 3 todos left, got %d", len(collection.Todos))
+	}
+	if parent := parentOf(t, collection, "Compile"); parent != 0 {
+		t.Errorf("Expected the subtask of a todo removed to lose its parent, got %d", parent)
+	}
+	callMum := collection.Todos[2]
+	if callMum.ID != 5 || joinIDs(callMum.DependsOn) != "4" {
+		t.Errorf("Expected the todo 5 to only wait for 4, got %d waiting for %s", callMum.ID, joinIDs(callMum.DependsOn))
+	}
+
+	if _, err := collection.Remove([]int64{1, 9}); err == nil {
+		t.Error("Expected a missing todo to fail")
+	}
+	if len(collection.Todos) != 3 {
+		t.Error("Expected nothing to be removed when a todo is missing")
+	}
+}
+
+func TestMarkDone(t *testing.T) {
+	useStatuses(t, "pending,wip,done,dropped:finished")
+	collection := subtaskCollection()
+	collection.SetStatus(5, "dropped")
+	completed := collection.Todos[4].Completed
+
+	// 4 is done with its parent 3 but reported as it was
+	marked, already, err := collection.MarkDone([]int64{3, 4, 5})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(marked) != 2 || len(already) != 1 || already[0].ID != 5 {
+		t.Fatalf("Expected 3 and 4 to be marked and 5 to be already done, got %d and %d", len(marked), len(already))
+	}
+	if collection.Todos[3].Status != DONE || collection.Todos[4].Status != "dropped" || !collection.Todos[4].Completed.Equal(completed) {
+		t.Error("Expected the todos to be done, and the one dropped to be left as it was")
+	}
+
+	if _, _, err := collection.MarkDone([]int64{1, 9}); err == nil {
+		t.Error("Expected a missing todo to fail")
+	}
+	if collection.Todos[0].IsFinished() {
+		t.Error("Expected nothing to change when a todo is missing")
+	}
+}
+
+func TestMarkPending(t *testing.T) {
+	collection := subtaskCollection()
+	collection.SetStatus(1, DONE)
+	collection.SetStatus(2, WIP)
+
+	marked, already, err := collection.MarkPending([]int64{1, 2, 5})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(marked) != 2 || len(already) != 1 || already[0].ID != 5 {
+		t.Fatalf("Expected 1 and 2 to be marked and 5 to be already pending, got %d and %d", len(marked), len(already))
+	}
+	for _, todo := range marked {
+		if todo.Status != PENDING || !todo.Completed.IsZero() || !todo.Started.IsZero() {
+			t.Errorf("Expected the todo %d to be pending, got %s", todo.ID, todo.Status)
+		}
+	}
+	if collection.Todos[2].Status != DONE {
+		t.Error("Expected the subtasks to stay done")
+	}
+}
@@ -23,6 +23,20 @@ var (
 	commit  = "none"
 )
 
+// sortFlag is shared by the commands listing todos
+var sortFlag = cli.StringFlag{
+	Name:   "sort",
+	Usage:  "sort the todos by a comma separated list of keys: priority, due, id, created",
+	EnvVar: "TODO_SORT",
+	Value:  "priority",
+}
+
+// whereFlag selects the todos changed by a command with a query
+var whereFlag = cli.StringFlag{
+	Name:  "where",
+	Usage: "change the todos matching a query, like 'tag:api status:wip'",
+}
+
 func init() {
 	flags = []cli.Flag{
 		cli.BoolFlag{
@@ -37,6 +51,31 @@ func init() {
 			Name:  "all, a",
 			Usage: "print all todos",
 		},
+		cli.BoolFlag{
+			Name:  "overdue",
+			Usage: "print only the todos whose due date has passed",
+		},
+		cli.StringFlag{
+			Name:  "due-before",
+			Usage: "print only the todos due before a date (2018-06-01, tomorrow, fri, +3d, eow...)",
+		},
+		cli.StringSliceFlag{
+			Name:  "tag",
+			Usage: "print only the todos having this tag (repeatable)",
+		},
+		cli.StringSliceFlag{
+			Name:  "not-tag",
+			Usage: "print only the todos not having this tag (repeatable)",
+		},
+		cli.StringFlag{
+			Name:  "project",
+			Usage: "print only the todos of a +project",
+		},
+		cli.BoolFlag{
+			Name:  "group, g",
+			Usage: "group the todos under their +project",
+		},
+		sortFlag,
 	}
 
 	cli.VersionPrinter = func(c *cli.Context) {
@@ -51,12 +90,32 @@ func init() {
 			UsageText: "td init",
 			Action:    initialize,
 		},
+		{
+			Name:      "where",
+			Usage:     "Show which file is used to store your todos and why",
+			UsageText: "td where",
+			Action:    where,
+		},
 		{
 			Name:      "add",
 			ShortName: "a",
 			Usage:     "Add a new todo",
-			UsageText: "td add \"call mum\"",
-			Action:    add,
+			UsageText: "td add [--due fri] [--every mon,thu] [--parent 3] \"call mum\"",
+			Flags: []cli.Flag{
+				cli.StringFlag{
+					Name:  "due",
+					Usage: "Date the todo must be done by (2018-06-01, tomorrow, fri, +3d, eow...)",
+				},
+				cli.StringFlag{
+					Name:  "every",
+					Usage: "Add the todo again once done: daily, weekly, monthly, mon,thu, 3d, 2w, 1m, or \"after 2w\" to count from its completion",
+				},
+				cli.StringFlag{
+					Name:  "parent",
+					Usage: "ID or UID of the todo the new one is a subtask of",
+				},
+			},
+			Action: add,
 		},
 		{
 			Name:      "modify",
@@ -65,26 +124,115 @@ func init() {
 			UsageText: "td modify 2 \"call dad\"",
 			Action:    modify,
 		},
+		{
+			Name:      "due",
+			Usage:     "Set the due date of a todo, or remove it with \"none\"",
+			UsageText: "td due 2 \"next mon\"",
+			Action:    due,
+		},
+		{
+			Name:      "priority",
+			ShortName: "p",
+			Usage:     "Set the priority of a todo: A (the highest) to E, high, medium, low, none, or + and - to bump it",
+			UsageText: "td priority 2 A",
+			Action:    priority,
+		},
 		{
 			Name:      "toggle",
 			ShortName: "t",
-			Usage:     "Toggle the status of a todo by giving his id",
-			UsageText: "td toggle 1",
-			Action:    toggle,
+			Usage:     "Toggle the status of todos by giving their ids, or a query",
+			UsageText: "td toggle 3 5 7-10 | td toggle --where 'tag:api status:wip'",
+			Flags: []cli.Flag{
+				whereFlag,
+			},
+			Action: toggle,
 		},
 		{
 			Name:      "wip",
 			ShortName: "w",
-			Usage:     "Change the status of a todo to \"Work In Progress\" by giving its id",
-			UsageText: "td wip 1",
-			Action:    wip,
+			Usage:     "Change the status of todos to \"Work In Progress\" by giving their ids, or a query",
+			UsageText: "td wip 3 5 7-10 | td wip --where tag:api",
+			Flags: []cli.Flag{
+				whereFlag,
+			},
+			Action: wip,
+		},
+		{
+			Name:      "done",
+			Usage:     "Mark todos as done by giving their ids, or a query",
+			UsageText: "td done 3 5 7-10 | td done --where tag:api",
+			Flags: []cli.Flag{
+				whereFlag,
+			},
+			Action: done,
+		},
+		{
+			Name:      "pending",
+			Aliases:   []string{"undo-done"},
+			Usage:     "Mark todos as pending again by giving their ids, or a query",
+			UsageText: "td pending 3 5 7-10 | td pending --where status:done",
+			Flags: []cli.Flag{
+				whereFlag,
+			},
+			Action: pending,
+		},
+		{
+			Name:      "status",
+			Usage:     "Change the status of todos to one of TODO_STATUSES",
+			UsageText: "td status 3 5 7-10 review | td status --where tag:api review",
+			Flags: []cli.Flag{
+				whereFlag,
+			},
+			Action: status,
+		},
+		{
+			Name:      "rm",
+			Usage:     "Remove todos for good by giving their ids, or a query",
+			UsageText: "td rm 3 5 7-10 | td rm --where tag:obsolete",
+			Flags: []cli.Flag{
+				whereFlag,
+			},
+			Action: remove,
 		},
 		{
 			Name:      "clean",
 			ShortName: "c",
 			Usage:     "Remove finished todos from the list",
-			UsageText: "td clean",
-			Action:    clean,
+			UsageText: "td clean [--older-than 30d]",
+			Flags: []cli.Flag{
+				cli.StringFlag{
+					Name:  "older-than",
+					Usage: "Remove only the todos finished before a date (2018-06-01, yesterday...) or a period (7d, 2w, 1m)",
+				},
+			},
+			Action: clean,
+		},
+		{
+			Name:      "archive",
+			Usage:     "List, search and restore the todos removed by clean",
+			UsageText: "td archive list|search|restore",
+			Subcommands: []cli.Command{
+				{
+					Name:      "list",
+					ShortName: "l",
+					Usage:     "List the archived todos",
+					UsageText: "td archive list",
+					Action:    archiveList,
+				},
+				{
+					Name:      "search",
+					ShortName: "s",
+					Usage:     "Search the archived todos matching a query, in their description or notes",
+					UsageText: "td archive search \"foo\"",
+					Action:    archiveSearch,
+				},
+				{
+					Name:      "restore",
+					Usage:     "Take back an archived todo in the list, designated by its UID",
+					UsageText: "td archive restore 3f9a",
+					Action:    archiveRestore,
+				},
+			},
 		},
 		{
 			Name:      "reorder",
@@ -106,12 +254,194 @@ func init() {
 			UsageText: "td swap 9 3",
 			Action:    swap,
 		},
+		{
+			Name:      "migrate",
+			Usage:     "Convert the file storing your todos to another format",
+			UsageText: "td migrate --to sqlite",
+			Flags: []cli.Flag{
+				cli.StringFlag{
+					Name:  "to",
+					Usage: "Format to convert to: sqlite or json",
+				},
+			},
+			Action: migrate,
+		},
+		{
+			Name:      "tags",
+			Usage:     "List the tags of your todos with their number of todos",
+			UsageText: "td tags [--all]",
+			Flags: []cli.Flag{
+				cli.BoolFlag{
+					Name:  "all, a",
+					Usage: "Count the done todos too",
+				},
+			},
+			Action: tags,
+		},
+		{
+			Name:      "projects",
+			Usage:     "List the +projects of your todos with their number of pending, started and done todos",
+			UsageText: "td projects",
+			Action:    projects,
+		},
+		{
+			Name:      "block",
+			Usage:     "Make a todo wait for other todos to be done",
+			UsageText: "td block 5 --on 4,7",
+			Flags: []cli.Flag{
+				cli.StringSliceFlag{
+					Name:  "on",
+					Usage: "IDs of the todos blocking it, comma separated or repeated",
+				},
+			},
+			Action: block,
+		},
+		{
+			Name:      "unblock",
+			Usage:     "Remove dependencies of a todo, all of them without --on",
+			UsageText: "td unblock 5 [--on 4]",
+			Flags: []cli.Flag{
+				cli.StringSliceFlag{
+					Name:  "on",
+					Usage: "IDs of the todos not blocking it anymore, comma separated or repeated",
+				},
+			},
+			Action: unblock,
+		},
+		{
+			Name:      "next",
+			ShortName: "n",
+			Usage:     "List the todos not done and not blocked by another todo",
+			UsageText: "td next [--sort priority]",
+			Flags:     []cli.Flag{sortFlag},
+			Action:    next,
+		},
+		{
+			Name:      "note",
+			Usage:     "Add a note to a todo, read from the standard input with \"-\"",
+			UsageText: "td note 3 \"the plumber comes at 10\"",
+			Action:    note,
+		},
+		{
+			Name:      "show",
+			Usage:     "Show a todo with its notes and all its details",
+			UsageText: "td show 3",
+			Action:    show,
+		},
+		{
+			Name:      "history",
+			Usage:     "Show the changes of a todo, or of all the todos, with their date and author",
+			UsageText: "td history [--since 7d] [3]",
+			Flags: []cli.Flag{
+				cli.StringFlag{
+					Name:  "since",
+					Usage: "Show only the changes since a date (2018-06-01, yesterday...) or a period (7d, 2w, 1m)",
+				},
+			},
+			Action: history,
+		},
+		{
+			Name:      "undo",
+			Usage:     "Undo the last command which changed your todos",
+			UsageText: "td undo",
+			Action:    undo,
+		},
+		{
+			Name:      "redo",
+			Usage:     "Redo the last command undone",
+			UsageText: "td redo",
+			Action:    redo,
+		},
+		{
+			Name:      "log",
+			Usage:     "Show the journal of the last commands which changed your todos, the newest first",
+			UsageText: "td log",
+			Action:    showJournal,
+		},
+		{
+			Name:      "list",
+			ShortName: "ls",
+			Usage:     "List the todos matching a query, the finished ones only when it is about the status",
+			UsageText: "td list [--all] [--sort due] [--group] 'status:wip tag:api due<+7d \"login bug\" -tag:later'",
+			Flags: []cli.Flag{
+				cli.BoolFlag{
+					Name:  "all, a",
+					Usage: "List the finished todos too",
+				},
+				cli.BoolFlag{
+					Name:  "group, g",
+					Usage: "Group the todos under their +project",
+				},
+				sortFlag,
+			},
+			Action: list,
+		},
+		{
+			Name:      "view",
+			ShortName: "v",
+			Usage:     "List the todos of a view, a query saved by name",
+			UsageText: "td view [--sort due] [--group] standup",
+			Flags: []cli.Flag{
+				cli.BoolFlag{
+					Name:  "group, g",
+					Usage: "Group the todos under their +project",
+				},
+				sortFlag,
+			},
+			Action: view,
+			Subcommands: []cli.Command{
+				{
+					Name:      "save",
+					Usage:     "Save a query as a view, replacing the view of the same name",
+					UsageText: "td view save standup 'status:wip OR completed:yesterday'",
+					Action:    viewSave,
+				},
+				{
+					Name:      "list",
+					ShortName: "ls",
+					Usage:     "List the views with their query",
+					UsageText: "td view list",
+					Action:    viewList,
+				},
+				{
+					Name:      "rm",
+					Usage:     "Remove a view",
+					UsageText: "td view rm standup",
+					Action:    viewRemove,
+				},
+				{
+					Name:      "default",
+					Usage:     "Set the view listed by td without arguments, or none to list the todos not done",
+					UsageText: "td view default standup|none",
+					Action:    viewDefault,
+				},
+			},
+		},
 		{
 			Name:      "search",
 			ShortName: "s",
-			Usage:     "Search a string in all todos",
-			UsageText: "td search \"project-1\"",
-			Action:    search,
+			Usage:     "Search the todos matching a query, like a string, in all todos",
+			UsageText: "td search [--notes] [--regex|--word|--fuzzy] [--sort priority] \"project-1\" status:wip",
+			Flags: []cli.Flag{
+				sortFlag,
+				cli.BoolFlag{
+					Name:  "notes, n",
+					Usage: "Search in the notes of the todos too",
+				},
+				cli.BoolFlag{
+					Name:  "regex, r",
+					Usage: "Search a regular expression instead of a query",
+				},
+				cli.BoolFlag{
+					Name:  "word, w",
+					Usage: "Search whole words instead of a query",
+				},
+				cli.BoolFlag{
+					Name:  "fuzzy, f",
+					Usage: "Search words even with typos instead of a query, the best matches first",
+				},
+			},
+			Action: search,
 		},
 	}
 	authors = []cli.Author{
@@ -155,8 +485,15 @@ func main() {
 
 	app.Before = func(c *cli.Context) error {
 
+		if err := LoadStatuses(); err != nil {
+			return cli.NewExitError(err, 1)
+		}
+		if err := LoadToggle(); err != nil {
+			return cli.NewExitError(err, 1)
+		}
+
 		if len(c.Args()) == 1 {
-			exceptions := []string{"init", "i", "help", "h"}
+			exceptions := []string{"init", "i", "where", "help", "h"}
 			for _, x := range exceptions {
 				if c.Args()[0] == x {
 					return nil
@@ -183,8 +520,10 @@ ERROR:
 
   Example 'export TODO_DB_PATH=$HOME/Dropbox/todo.json'
 
-  If 'TODO_DB_PATH' is blank, it will reference to a file named '.todos' in the
-  current working folder, and if there's no file, it will create one.
+  If 'TODO_DB_PATH' is blank, it will look for a file named '.todos' in the
+  current working folder and then in each parent folder, up to the root of the
+  repository or a folder listed in 'TODO_DB_CEILING'. Run 'td where' to see
+  which file is picked and why.
 
 ===============================================================================
 
@@ -4,9 +4,10 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
-	"os"
 	"regexp"
+	"sort"
 	"strconv"
+	"strings"
 	"time"
 
 	"github.com/deild/td/db"
@@ -25,6 +26,23 @@ const PENDING = "pending"
 //Collection of todo
 type Collection struct {
 	Todos []*Todo
+	// store is where the todos are retrieved from and written to
+	store db.Store
+	// partial is set when only a selection of the todos was retrieved
+	partial bool
+	// Now is the clock used to timestamp the todos, time.Now when nil
+	Now func() time.Time
+	// User is the author of the changes, CurrentUser when empty
+	User string
+	// Command is recorded in the journal with the changes written by
+	// WriteTodos, nothing is recorded when it is empty
+	Command string
+	// loaded are the todos as they were retrieved, before the changes
+	loaded []json.RawMessage
+	// archived and restored are the todos moved to and from the archive
+	// since they were retrieved
+	archived []json.RawMessage
+	restored []json.RawMessage
 }
 
 // NewCollection create a new collection
@@ -38,6 +56,38 @@ func NewCollection() (*Collection, error) {
 	return collection, nil
 }
 
+// NewCollectionFromStore create a new collection from the todos of a store
+func NewCollectionFromStore(store db.Store) (*Collection, error) {
+	var collection = &Collection{store: store}
+
+	if err := collection.RetrieveTodos(); err != nil {
+		return nil, err
+	}
+
+	return collection, nil
+}
+
+// NewCollectionWhere create a read-only collection of the todos matching
+// filter. When the store is a db.Querier, only those todos are retrieved;
+// otherwise all the todos are, and the caller still has to filter them.
+func NewCollectionWhere(filter db.Filter) (*Collection, error) {
+	var collection = new(Collection)
+
+	if err := collection.retrieve(&filter); err != nil {
+		return nil, err
+	}
+
+	return collection, nil
+}
+
+// now returns the current time of the collection clock, to the second
+func (c *Collection) now() time.Time {
+	if c.Now != nil {
+		return c.Now().Truncate(time.Second)
+	}
+	return time.Now().Truncate(time.Second)
+}
+
 // RemoveAtIndex remove one todo with its index
 func (c *Collection) RemoveAtIndex(item int) {
 	s := *c
@@ -45,51 +95,140 @@ func (c *Collection) RemoveAtIndex(item int) {
 	*c = s
 }
 
-// RetrieveTodos load todo from disk
-func (c *Collection) RetrieveTodos() error {
+// openStore returns the store of the collection, the one designated by
+// TODO_DB_PATH or the .todos lookup when none was given
+func (c *Collection) openStore() (db.Store, error) {
+	if c.store != nil {
+		return c.store, nil
+	}
 	data, err := db.NewDataStore()
+	if err != nil {
+		return nil, err
+	}
+	c.store, err = data.Store()
+	return c.store, err
+}
+
+// RetrieveTodos load todo from the store. The store stays locked until
+// WriteTodos or Close is called.
+func (c *Collection) RetrieveTodos() error {
+	return c.retrieve(nil)
+}
+
+func (c *Collection) retrieve(filter *db.Filter) error {
+	store, err := c.openStore()
 	if err != nil {
 		return err
 	}
-	if err = data.Check(); err != nil {
+	if err = store.Check(); err != nil {
+		return err
+	}
+	if err = store.Lock(); err != nil {
 		return err
 	}
 
-	file, err := os.OpenFile(data.Path, os.O_RDONLY, 0600)
+	var records []json.RawMessage
+	if querier, ok := store.(db.Querier); ok && filter != nil {
+		c.partial = true
+		records, err = querier.Query(*filter)
+	} else {
+		records, err = store.Load()
+	}
 	if err != nil {
+		c.Close()
 		return err
 	}
-	defer helper.Check(file.Close)
-	err = json.NewDecoder(file).Decode(&c.Todos)
-	return err
+	if c.Todos, err = decodeTodos(records); err != nil {
+		c.Close()
+		return err
+	}
+	c.loaded = records
+	return nil
 }
 
-// WriteTodos write the collection on disk
+// query returns the todos of the store matching filter
+func (c *Collection) query(querier db.Querier, filter db.Filter) ([]*Todo, error) {
+	records, err := querier.Query(filter)
+	if err != nil {
+		return nil, err
+	}
+	return decodeTodos(records)
+}
+
+func decodeTodos(records []json.RawMessage) ([]*Todo, error) {
+	todos := make([]*Todo, len(records))
+	for i, record := range records {
+		todos[i] = new(Todo)
+		if err := json.Unmarshal(record, todos[i]); err != nil {
+			return nil, err
+		}
+		if todos[i].Tags == nil {
+			// todos written before the tags were stored
+			todos[i].syncTags()
+		}
+		if todos[i].Project == "" {
+			// todos written before the projects were stored
+			todos[i].syncProject()
+		}
+	}
+	return todos, nil
+}
+
+// Close release the lock taken on the store by RetrieveTodos
+func (c *Collection) Close() error {
+	if c.store == nil {
+		return nil
+	}
+	return c.store.Unlock()
+}
+
+// WriteTodos write the collection in the store and release the lock
 func (c *Collection) WriteTodos() error {
-	data, err := db.NewDataStore()
+	if c.partial {
+		return errors.New("Can't write a collection holding only a selection of the todos")
+	}
+	store, err := c.openStore()
 	if err != nil {
 		return err
 	}
+	if err = store.Lock(); err != nil {
+		return err
+	}
+	defer helper.Check(c.Close)
 
-	file, err := os.OpenFile(data.Path, os.O_RDWR|os.O_TRUNC, 0600)
-	if err != nil {
+	records := make([]json.RawMessage, len(c.Todos))
+	for i, todo := range c.Todos {
+		if records[i], err = json.Marshal(todo); err != nil {
+			return err
+		}
+	}
+	if err = store.Save(records); err != nil {
 		return err
 	}
-	defer helper.Check(file.Close)
-	dataM, err := json.MarshalIndent(&c.Todos, "", "  ")
-	if err != nil {
+	// the todos restored leave the archive only once they are in the list
+	if err = db.Unarchive(store, c.restored); err != nil {
 		return err
 	}
-	if _, err = file.Write(dataM); err != nil {
+	before := c.loaded
+	c.loaded = records
+	if c.Command == "" {
+		c.archived, c.restored = nil, nil
+		return nil
+	}
+
+	journal, err := db.OpenJournal(store)
+	if err != nil {
 		return err
 	}
-	return file.Sync()
+	entry := db.Entry{Command: c.Command, Date: c.now(), Before: before, After: records, Archived: c.archived, Restored: c.restored}
+	c.archived, c.restored = nil, nil
+	return journal.Record(entry)
 }
 
-// ListPendingTodos keep only pending todo
+// ListPendingTodos keep only pending todo, having the first status
 func (c *Collection) ListPendingTodos() error {
 	for i := len(c.Todos) - 1; i >= 0; i-- {
-		if c.Todos[i].Status != PENDING {
+		if c.Todos[i].Status != initialStatus() {
 			c.RemoveAtIndex(i)
 		}
 	}
@@ -99,16 +238,16 @@ func (c *Collection) ListPendingTodos() error {
 // ListUndoneTodos remove finished todos from the list
 func (c *Collection) ListUndoneTodos() {
 	for i := len(c.Todos) - 1; i >= 0; i-- {
-		if c.Todos[i].Status == DONE {
+		if c.Todos[i].IsFinished() {
 			c.RemoveAtIndex(i)
 		}
 	}
 }
 
-// ListDoneTodos keep only done todo
+// ListDoneTodos keep only done todo, having a finished status
 func (c *Collection) ListDoneTodos() {
 	for i := len(c.Todos) - 1; i >= 0; i-- {
-		if c.Todos[i].Status != DONE {
+		if !c.Todos[i].IsFinished() {
 			c.RemoveAtIndex(i)
 		}
 	}
@@ -123,9 +262,67 @@ func (c *Collection) ListWorkInProgressTodos() {
 	}
 }
 
+// ListOverdueTodos keep only the todos whose due date has passed
+func (c *Collection) ListOverdueTodos() {
+	now := c.now()
+	for i := len(c.Todos) - 1; i >= 0; i-- {
+		if !c.Todos[i].IsOverdue(now) {
+			c.RemoveAtIndex(i)
+		}
+	}
+}
+
+// ListDueBefore keep only the todos due before a day
+func (c *Collection) ListDueBefore(date time.Time) {
+	for i := len(c.Todos) - 1; i >= 0; i-- {
+		if c.Todos[i].Due.IsZero() || !c.Todos[i].Due.Before(day(date)) {
+			c.RemoveAtIndex(i)
+		}
+	}
+}
+
+// ListTagged keep only the todos having all the tags
+func (c *Collection) ListTagged(tags []string) {
+	for i := len(c.Todos) - 1; i >= 0; i-- {
+		for _, tag := range tags {
+			if !c.Todos[i].HasTag(tag) {
+				c.RemoveAtIndex(i)
+				break
+			}
+		}
+	}
+}
+
+// ListNotTagged remove the todos having any of the tags
+func (c *Collection) ListNotTagged(tags []string) {
+	for i := len(c.Todos) - 1; i >= 0; i-- {
+		for _, tag := range tags {
+			if c.Todos[i].HasTag(tag) {
+				c.RemoveAtIndex(i)
+				break
+			}
+		}
+	}
+}
+
+// Tags returns the number of todos for each tag
+func (c *Collection) Tags() map[string]int {
+	counts := map[string]int{}
+	for _, todo := range c.Todos {
+		for _, tag := range todo.Tags {
+			counts[tag]++
+		}
+	}
+	return counts
+}
+
 // CreateTodo new todo in the list
 func (c *Collection) CreateTodo(newTodo *Todo) (int64, error) {
 	var err error
+	if err = c.checkParent(newTodo); err != nil {
+		return 0, err
+	}
+
 	var highestID int64
 	for _, todo := range c.Todos {
 		if todo.ID > highestID {
@@ -134,7 +331,21 @@ func (c *Collection) CreateTodo(newTodo *Todo) (int64, error) {
 	}
 
 	newTodo.ID = (highestID + 1)
-	newTodo.Modified = time.Now().Local().String()
+	if newTodo.UID == "" {
+		newTodo.UID = newUID()
+	}
+	newTodo.syncTags()
+	newTodo.syncProject()
+	now := c.now()
+	newTodo.Created = now
+	newTodo.Modified = now
+	switch {
+	case newTodo.IsFinished():
+		newTodo.Completed = now
+	case newTodo.Status != initialStatus():
+		newTodo.Started = now
+	}
+	c.record(newTodo, now, EventCreated, "", "")
 	c.Todos = append(c.Todos, newTodo)
 
 	return newTodo.ID, err
@@ -164,33 +375,63 @@ func (c *Collection) SetStatus(id int64, status string) (*Todo, error) {
 		return todo, err
 	}
 
-	todo.Status = status
+	if todo.Status == status {
+		return todo, err
+	}
+	if !isStatus(status) {
+		return todo, fmt.Errorf("The status %s is unknown, it must be one of: %s.", status, statusNames())
+	}
 
-	todo.Modified = time.Now().Local().String()
+	wasFinished := todo.IsFinished()
+	now := c.now()
+	switch {
+	case statusOf(status).Finished:
+		if !wasFinished {
+			todo.Completed = now
+		}
+	case status == initialStatus():
+		todo.Started = time.Time{}
+		todo.Completed = time.Time{}
+	default:
+		// the todo keeps the date it was started when it moves from a
+		// stage to the next one
+		if todo.Started.IsZero() || wasFinished || todo.Status == initialStatus() {
+			todo.Started = now
+		}
+		todo.Completed = time.Time{}
+	}
+	c.record(todo, now, EventStatus, todo.Status, status)
+	todo.Status = status
+	todo.Modified = now
+
+	if todo.IsFinished() && !wasFinished {
+		// finishing a parent finishes its subtasks
+		for _, descendant := range c.Descendants(id) {
+			if descendant.IsFinished() {
+				continue
+			}
+			if _, err = c.SetStatus(descendant.ID, status); err != nil {
+				return todo, err
+			}
+		}
+		if _, err = c.recur(todo); err != nil {
+			return todo, err
+		}
+	}
 
 	return todo, err
 }
 
-// Toggle the status of a todo by giving his id
+// Toggle the status of a todo by giving his id, to the next status in the
+// order of TODO_STATUSES
 func (c *Collection) Toggle(id int64) (*Todo, error) {
-	var status string
-
 	todo, err := c.Find(id)
 
 	if err != nil {
 		return todo, err
 	}
 
-	switch todo.Status {
-	case PENDING:
-		status = WIP
-	case WIP:
-		status = DONE
-	default:
-		status = PENDING
-	}
-
-	return c.SetStatus(id, status)
+	return c.SetStatus(id, nextStatus(todo.Status))
 }
 
 // Modify the text of an existing todo
@@ -201,22 +442,92 @@ func (c *Collection) Modify(id int64, desc string) (*Todo, error) {
 		return todo, err
 	}
 
+	now := c.now()
+	if todo.Desc != desc {
+		c.record(todo, now, EventDesc, todo.Desc, desc)
+	}
 	todo.Desc = desc
-	todo.Modified = time.Now().Local().String()
+	todo.syncTags()
+	todo.syncProject()
+	todo.Modified = now
+
+	return todo, err
+}
+
+// SetDue set the due date of a todo, or remove it with a zero date
+func (c *Collection) SetDue(id int64, due time.Time) (*Todo, error) {
+	todo, err := c.Find(id)
+
+	if err != nil {
+		return todo, err
+	}
+
+	if !due.IsZero() {
+		due = day(due)
+	}
+	now := c.now()
+	if !todo.Due.Equal(due) {
+		c.record(todo, now, EventDue, dueValue(todo.Due), dueValue(due))
+	}
+	todo.Due = due
+	todo.Modified = now
 
 	return todo, err
 }
 
-// RemoveFinishedTodos remove finished todos from the list
-func (c *Collection) RemoveFinishedTodos() {
-	c.ListUndoneTodos()
+// SetPriority set the priority of a todo, empty to remove it
+func (c *Collection) SetPriority(id int64, priority string) (*Todo, error) {
+	todo, err := c.Find(id)
+
+	if err != nil {
+		return todo, err
+	}
+
+	now := c.now()
+	if todo.Priority != priority {
+		c.record(todo, now, EventPriority, todo.Priority, priority)
+	}
+	todo.Priority = priority
+	todo.Modified = now
+
+	return todo, err
+}
+
+// RemoveFinishedTodos remove finished todos from the list, and returns them.
+// A done todo having subtasks not done yet is kept with them. The todos
+// blocked by a removed todo no longer depend on it.
+func (c *Collection) RemoveFinishedTodos() []*Todo {
+	return c.RemoveTodosDoneBefore(time.Time{})
+}
+
+// RemoveTodosDoneBefore remove the todos completed before a date, like
+// RemoveFinishedTodos does. A zero date removes all the done todos, and a
+// done todo without completion date is considered completed long ago.
+func (c *Collection) RemoveTodosDoneBefore(date time.Time) []*Todo {
+	old := c.ids()
+	defer c.renumbered(old)
+
+	var removed []*Todo
+	for i := len(c.Todos) - 1; i >= 0; i-- {
+		todo := c.Todos[i]
+		if !todo.IsFinished() || c.hasUnfinishedDescendant(todo.ID) {
+			continue
+		}
+		if date.IsZero() || todo.Completed.Before(date) {
+			removed = append([]*Todo{todo}, removed...)
+			c.RemoveAtIndex(i)
+		}
+	}
+	return removed
 }
 
 // Reorder the collection
 func (c *Collection) Reorder() error {
+	old := c.ids()
 	for i, todo := range c.Todos {
 		todo.ID = int64(i + 1)
 	}
+	c.renumbered(old)
 	return nil
 
 }
@@ -226,6 +537,7 @@ func (c *Collection) Swap(idA int64, idB int64) error {
 	var positionA int
 	var positionB int
 
+	old := c.ids()
 	for i, todo := range c.Todos {
 		switch todo.ID {
 		case idA:
@@ -238,10 +550,62 @@ func (c *Collection) Swap(idA int64, idB int64) error {
 	}
 
 	c.Todos[positionA], c.Todos[positionB] = c.Todos[positionB], c.Todos[positionA]
+	c.renumbered(old)
 	return nil
 
 }
 
+// sortKeys compare two todos, returning a negative number when a comes first
+var sortKeys = map[string]func(a *Todo, b *Todo) int{
+	"priority": func(a *Todo, b *Todo) int {
+		return priorityRank(a.Priority) - priorityRank(b.Priority)
+	},
+	"due": func(a *Todo, b *Todo) int {
+		switch {
+		case a.Due.Equal(b.Due):
+			return 0
+		case a.Due.IsZero():
+			return 1
+		case b.Due.IsZero():
+			return -1
+		}
+		return a.Due.Compare(b.Due)
+	},
+	"id": func(a *Todo, b *Todo) int {
+		return int(a.ID - b.ID)
+	},
+	"created": func(a *Todo, b *Todo) int {
+		return a.Created.Compare(b.Created)
+	},
+}
+
+// Sort the todos by a comma separated list of keys: priority, due, id or
+// created. The IDs are not changed.
+func (c *Collection) Sort(keys string) error {
+	var compare []func(a *Todo, b *Todo) int
+	for _, key := range strings.Split(keys, ",") {
+		key = strings.TrimSpace(key)
+		if key == "" {
+			continue
+		}
+		cmp, ok := sortKeys[key]
+		if !ok {
+			return fmt.Errorf("Can't sort by \"%s\": use priority, due, id or created", key)
+		}
+		compare = append(compare, cmp)
+	}
+
+	sort.SliceStable(c.Todos, func(i, j int) bool {
+		for _, cmp := range compare {
+			if order := cmp(c.Todos[i], c.Todos[j]); order != 0 {
+				return order < 0
+			}
+		}
+		return false
+	})
+	return nil
+}
+
 // Search retains only the elements that matches a sentence
 func (c *Collection) Search(sentence string) {
 	sentence = regexp.QuoteMeta(sentence)
@@ -274,6 +638,7 @@ func (c *Collection) ReorderByIDs(ids []int64) error {
 		rest = append(rest, todo)
 	}
 
+	old := c.ids()
 	newTodos := make([]*Todo, len(c.Todos))
 	index := 0
 	var idCounter int64 = 1
@@ -294,6 +659,7 @@ func (c *Collection) ReorderByIDs(ids []int64) error {
 	}
 
 	c.Todos = newTodos
+	c.renumbered(old)
 
 	return nil
 }
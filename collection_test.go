@@ -1,9 +1,13 @@
 package main
 
 import (
+	"encoding/json"
 	"fmt"
 	"os"
+	"os/exec"
 	"path"
+	"reflect"
+	"strings"
 	"testing"
 	"time"
 
@@ -428,3 +432,310 @@ func TestReorder(t *testing.T) {
 	}
 
 }
+
+const (
+	concurrentWriters = 8
+	todosPerWriter    = 10
+)
+
+func TestConcurrentWriters(t *testing.T) {
+	if os.Getenv("TD_TEST_WRITER") != "" {
+		for i := 0; i < todosPerWriter; i++ {
+			collection, err := NewCollection()
+			if err != nil {
+				t.Fatal(err)
+			}
+			task := NewTodo()
+			task.Desc = fmt.Sprintf("Written by %d", os.Getpid())
+			if _, err := collection.CreateTodo(task); err != nil {
+				t.Fatal(err)
+			}
+			if err := collection.WriteTodos(); err != nil {
+				t.Fatal(err)
+			}
+		}
+		return
+	}
+
+	createTmpTodo(t)
+	defer removeTmpTodo()
+
+	writers := make([]*exec.Cmd, concurrentWriters)
+	for i := range writers {
+		writers[i] = exec.Command(os.Args[0], "-test.run=^TestConcurrentWriters$")
+		writers[i].Env = append(os.Environ(), "TD_TEST_WRITER=1", db.EnvLockTimeout+"=30s")
+		if err := writers[i].Start(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, writer := range writers {
+		if err := writer.Wait(); err != nil {
+			t.Fatal("a writer failed", err)
+		}
+	}
+
+	collection, err := NewCollection()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer collection.Close()
+
+	if len(collection.Todos) != concurrentWriters*todosPerWriter {
+		t.Errorf("Expected %d todos, got %d", concurrentWriters*todosPerWriter, len(collection.Todos))
+	}
+	ids := map[int64]bool{}
+	for _, todo := range collection.Todos {
+		if ids[todo.ID] {
+			t.Errorf("The ID %d is used twice", todo.ID)
+		}
+		ids[todo.ID] = true
+	}
+}
+
+func TestLockedCollection(t *testing.T) {
+	createTmpTodo(t)
+	defer removeTmpTodo()
+	os.Setenv(db.EnvLockTimeout, "50ms")
+	defer os.Unsetenv(db.EnvLockTimeout)
+
+	collection, err := NewCollection()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer collection.Close()
+
+	_, err = NewCollection()
+	if err == nil {
+		t.Fatal("Expected the second collection to be locked out")
+	}
+	expected := fmt.Sprintf("locked by pid %d", os.Getpid())
+	if !strings.Contains(err.Error(), expected) {
+		t.Errorf("Expected error to contain \"%s\", got \"%s\"", expected, err)
+	}
+}
+
+func TestCollectionFromStore(t *testing.T) {
+	store := db.NewMemStore(t.Name())
+	store.Initialize()
+
+	collection, err := NewCollectionFromStore(store)
+	if err != nil {
+		t.Fatal(err)
+	}
+	task := NewTodo()
+	task.Desc = "Stored in memory"
+	collection.CreateTodo(task)
+	if err := collection.WriteTodos(); err != nil {
+		t.Fatal(err)
+	}
+
+	collection, err = NewCollectionFromStore(store)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer collection.Close()
+	if len(collection.Todos) != 1 || collection.Todos[0].Desc != task.Desc {
+		t.Errorf("Expected to retrieve the todo written in the store, got %d todos", len(collection.Todos))
+	}
+}
+
+func TestWriteTodosRecordsCommand(t *testing.T) {
+	store := db.NewMemStore(t.Name())
+	store.Initialize()
+
+	collection, _ := NewCollectionFromStore(store)
+	collection.CreateTodo(NewTodo())
+	collection.WriteTodos()
+
+	collection, _ = NewCollectionFromStore(store)
+	collection.Command = "td toggle 1"
+	collection.Toggle(1)
+	collection.WriteTodos()
+	// an unchanged list is not recorded
+	collection.Command = "td wip 1"
+	collection.WriteTodos()
+
+	journal, err := db.OpenJournal(store)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(journal.Entries) != 1 || journal.Entries[0].Command != "td toggle 1" {
+		t.Fatalf("Expected only the toggle to be recorded, got %+v", journal.Entries)
+	}
+
+	if _, err := journal.Undo(store); err != nil {
+		t.Fatal(err)
+	}
+	collection, _ = NewCollectionFromStore(store)
+	defer collection.Close()
+	if collection.Todos[0].Status != PENDING {
+		t.Errorf("Expected the toggle to be undone, got \"%s\"", collection.Todos[0].Status)
+	}
+}
+
+func TestCommandLine(t *testing.T) {
+	line := commandLine([]string{"add", "--due", "fri", "call mum", ""})
+	if line != `td add --due fri "call mum" ""` {
+		t.Errorf("Expected the arguments to be quoted when needed, got %s", line)
+	}
+}
+
+// fixedClock returns a clock starting at a fixed date, moving one hour each call
+func fixedClock() func() time.Time {
+	now := time.Date(2018, 5, 25, 10, 0, 0, 0, time.UTC)
+	return func() time.Time {
+		now = now.Add(time.Hour)
+		return now
+	}
+}
+
+func TestTimestamps(t *testing.T) {
+	collection := Collection{Now: fixedClock()}
+	task := NewTodo()
+	collection.CreateTodo(task)
+
+	created := time.Date(2018, 5, 25, 11, 0, 0, 0, time.UTC)
+	if !task.Created.Equal(created) || !task.Modified.Equal(created) {
+		t.Errorf("Expected the todo to be created and modified at %s, got %s and %s", created, task.Created, task.Modified)
+	}
+
+	collection.Toggle(task.ID)
+	started := created.Add(time.Hour)
+	if !task.Started.Equal(started) || !task.Modified.Equal(started) {
+		t.Errorf("Expected the todo to be started at %s, got %s", started, task.Started)
+	}
+
+	collection.Toggle(task.ID)
+	completed := started.Add(time.Hour)
+	if !task.Completed.Equal(completed) || !task.Started.Equal(started) {
+		t.Errorf("Expected the todo to be completed at %s, got %s", completed, task.Completed)
+	}
+
+	collection.Toggle(task.ID)
+	if !task.Started.IsZero() || !task.Completed.IsZero() {
+		t.Error("Expected a pending todo to be neither started nor completed")
+	}
+
+	collection.Modify(task.ID, "New description")
+	modified := completed.Add(2 * time.Hour)
+	if !task.Modified.Equal(modified) || !task.Created.Equal(created) {
+		t.Errorf("Expected the todo to be modified at %s, got %s", modified, task.Modified)
+	}
+}
+
+func TestTimestampsSerialization(t *testing.T) {
+	collection := Collection{Now: fixedClock(), User: "tolva"}
+	task := NewTodo()
+	task.UID = "5f1e0c2a9b3d4e6f"
+	collection.CreateTodo(task)
+
+	data, err := json.Marshal(task)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := `{"id":1,"desc":"","status":"pending","created":"2018-05-25T11:00:00Z","modified":"2018-05-25T11:00:00Z","uid":"5f1e0c2a9b3d4e6f","history":[{"date":"2018-05-25T11:00:00Z","author":"tolva","action":"created"}]}`
+	if string(data) != expected {
+		t.Errorf("Expected %s, got %s", expected, data)
+	}
+}
+
+func TestDueDates(t *testing.T) {
+	collection, _ := collectionFromTaskDesk([]string{"Overdue", "Today", "Later", "None", "Done"})
+	collection.Now = func() time.Time { return time.Date(2018, 5, 25, 10, 0, 0, 0, time.Local) }
+	today := time.Date(2018, 5, 25, 0, 0, 0, 0, time.Local)
+	collection.SetDue(1, today.AddDate(0, 0, -2))
+	collection.SetDue(2, today.Add(15*time.Hour))
+	collection.SetDue(3, today.AddDate(0, 0, 10))
+	collection.SetDue(5, today.AddDate(0, 0, -2))
+	collection.SetStatus(5, DONE)
+
+	if due := collection.Todos[1].Due; !due.Equal(today) {
+		t.Errorf("Expected the due date to be the start of the day, got %s", due)
+	}
+
+	overdue := collection
+	overdue.Todos = append([]*Todo{}, collection.Todos...)
+	overdue.ListOverdueTodos()
+	if len(overdue.Todos) != 1 || overdue.Todos[0].ID != 1 {
+		t.Errorf("Expected only the todo 1 to be overdue, got %d todos", len(overdue.Todos))
+	}
+
+	before := collection
+	before.Todos = append([]*Todo{}, collection.Todos...)
+	before.ListDueBefore(today.AddDate(0, 0, 1))
+	if len(before.Todos) != 3 {
+		t.Errorf("Expected 3 todos due before tomorrow, got %d", len(before.Todos))
+	}
+
+	collection.SetDue(1, time.Time{})
+	if !collection.Todos[0].Due.IsZero() {
+		t.Error("Expected the due date to be removed")
+	}
+}
+
+func TestSortTodos(t *testing.T) {
+	collection, _ := collectionFromTaskDesk([]string{"1", "2", "3", "4", "5"})
+	collection.SetPriority(2, "C")
+	collection.SetPriority(3, "A")
+	collection.SetPriority(5, "C")
+	collection.SetDue(5, time.Date(2018, 6, 1, 0, 0, 0, 0, time.Local))
+
+	if err := collection.Sort("priority,due,id"); err != nil {
+		t.Fatal(err)
+	}
+	expected := []int64{3, 5, 2, 1, 4}
+	for i, id := range expected {
+		if collection.Todos[i].ID != id {
+			t.Errorf("Expected the todo %d at position %d, got %d", id, i, collection.Todos[i].ID)
+		}
+	}
+
+	collection.Sort("id")
+	if collection.Todos[0].ID != 1 {
+		t.Errorf("Expected the todos to be sorted by id, got %d first", collection.Todos[0].ID)
+	}
+
+	if err := collection.Sort("size"); err == nil {
+		t.Error("Expected an unknown sort key to fail")
+	}
+}
+
+func TestTags(t *testing.T) {
+	collection, _ := collectionFromTaskDesk([]string{"Call #work", "Prepare the #workshop", "#Work on #api"})
+	for _, todo := range collection.Todos {
+		todo.syncTags()
+	}
+
+	counts := collection.Tags()
+	expected := map[string]int{"work": 2, "workshop": 1, "api": 1}
+	if !reflect.DeepEqual(counts, expected) {
+		t.Errorf("Expected the tags %v, got %v", expected, counts)
+	}
+
+	tagged := collection
+	tagged.Todos = append([]*Todo{}, collection.Todos...)
+	tagged.ListTagged([]string{"work"})
+	if len(tagged.Todos) != 2 || tagged.Todos[0].ID != 1 || tagged.Todos[1].ID != 3 {
+		t.Errorf("Expected the todos 1 and 3 to be tagged #work, got %d todos", len(tagged.Todos))
+	}
+
+	collection.ListNotTagged([]string{"api", "workshop"})
+	if len(collection.Todos) != 1 || collection.Todos[0].ID != 1 {
+		t.Errorf("Expected only the todo 1 without #api nor #workshop, got %d todos", len(collection.Todos))
+	}
+}
+
+func TestTagsFollowDescription(t *testing.T) {
+	var collection Collection
+	task := NewTodo()
+	task.Desc = "Call #work"
+	collection.CreateTodo(task)
+	if !task.HasTag("work") {
+		t.Error("Expected the tags to be parsed on creation")
+	}
+
+	collection.Modify(task.ID, "Call #home")
+	if task.HasTag("work") || !task.HasTag("home") {
+		t.Errorf("Expected the tags to follow the description, got %q", task.Tags)
+	}
+}
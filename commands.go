@@ -1,17 +1,24 @@
 package main
 
 import (
+	"errors"
 	"fmt"
+	"io/ioutil"
+	"os"
+	"sort"
 	"strconv"
+	"strings"
+	"time"
 
 	"github.com/daviddengcn/go-colortext"
 	"github.com/deild/td/db"
+	"github.com/deild/td/helper"
 	"github.com/urfave/cli"
 )
 
 // Initialize a collection of todos
 func initialize(c *cli.Context) error {
-	ds, err := db.NewDataStore()
+	ds, err := db.NewLocalDataStore()
 	if err != nil {
 		return exitError(err)
 	}
@@ -24,6 +31,21 @@ func initialize(c *cli.Context) error {
 	return nil
 }
 
+// Explain which database file is used
+func where(c *cli.Context) error {
+	ds, err := db.NewDataStore()
+	if err != nil {
+		return exitError(err)
+	}
+
+	fmt.Println(ds.Path)
+	printSucces("Picked because %s.\n", ds.Reason)
+	if err := ds.Check(); err != nil {
+		printSucces("The file doesn't exist yet, run 'td init' to create it.\n")
+	}
+	return nil
+}
+
 // Add a new todo
 func add(c *cli.Context) error {
 
@@ -32,13 +54,35 @@ func add(c *cli.Context) error {
 			fmt.Errorf("You must provide a name to your todo.\nUsage: %s", c.Command.UsageText))
 	}
 
-	collection, err := NewCollection()
+	collection, err := openCollection(c)
 	if err != nil {
 		return exitError(err)
 	}
+	defer helper.Check(collection.Close)
 
 	todo := NewTodo()
 	todo.Desc = c.Args()[0]
+	if c.String("parent") != "" {
+		if todo.Parent, err = collection.Resolve(c.String("parent")); err != nil {
+			return exitError(err)
+		}
+	}
+	if c.String("due") != "" {
+		if todo.Due, err = ParseDate(c.String("due"), time.Now()); err != nil {
+			return exitError(err)
+		}
+	}
+	if c.String("every") != "" {
+		if todo.Recur, err = ParseRecurrence(c.String("every")); err != nil {
+			return exitError(err)
+		}
+		if todo.Due.IsZero() {
+			todo.Due = todo.Recur.First(time.Now())
+		}
+		if todo.Recur.Unit == Monthly {
+			todo.Recur.Day = todo.Due.Day()
+		}
+	}
 
 	id, err := collection.CreateTodo(todo)
 	if err != nil {
@@ -60,12 +104,13 @@ func modify(c *cli.Context) error {
 			fmt.Errorf("You must provide the id and the new text for your todo.\nUsage: %s", c.Command.UsageText))
 	}
 
-	collection, err := NewCollection()
+	collection, err := openCollection(c)
 	if err != nil {
 		return exitError(err)
 	}
+	defer helper.Check(collection.Close)
 
-	id, err := strconv.ParseInt(c.Args()[0], 10, 32)
+	id, err := collection.Resolve(c.Args()[0])
 	if err != nil {
 		return exitError(err)
 	}
@@ -83,25 +128,32 @@ func modify(c *cli.Context) error {
 	return nil
 }
 
-func toggle(c *cli.Context) error {
+func due(c *cli.Context) error {
 
-	if len(c.Args()) != 1 {
+	if len(c.Args()) != 2 {
 		return exitError(
-			fmt.Errorf("You must provide the position of the item you want to change.\nUsage: %s", c.Command.UsageText))
+			fmt.Errorf("You must provide the id and the due date of your todo.\nUsage: %s", c.Command.UsageText))
 	}
 
-	collection, err := NewCollection()
+	collection, err := openCollection(c)
 	if err != nil {
 		return exitError(err)
 	}
+	defer helper.Check(collection.Close)
 
-	id, err := strconv.ParseInt(c.Args()[0], 10, 32)
+	id, err := collection.Resolve(c.Args()[0])
 	if err != nil {
 		return exitError(err)
 	}
 
-	todo, err := collection.Toggle(id)
-	if err != nil {
+	var date time.Time
+	if c.Args()[1] != "none" {
+		if date, err = ParseDate(c.Args()[1], time.Now()); err != nil {
+			return exitError(err)
+		}
+	}
+
+	if _, err = collection.SetDue(id, date); err != nil {
 		return exitError(err)
 	}
 
@@ -109,74 +161,86 @@ func toggle(c *cli.Context) error {
 		return exitError(err)
 	}
 
-	var status string
-
-	switch todo.Status {
-	case "wip":
-		status = "marked as work in progress"
-	default:
-		status = "marked as " + todo.Status
+	if date.IsZero() {
+		printSucces("Your todo %d has no due date anymore.\n", id)
+	} else {
+		printSucces("Your todo %d is now due on %s.\n", id, date.Format(dateLayout))
 	}
-
-	printSucces("Your todo %d is now %s.\n", id, status)
 	return nil
 }
 
-func search(c *cli.Context) error {
-	if len(c.Args()) != 1 {
+func priority(c *cli.Context) error {
+
+	if len(c.Args()) != 2 {
 		return exitError(
-			fmt.Errorf("You must provide a string search.\nUsage: %s", c.Command.UsageText))
+			fmt.Errorf("You must provide the id and the priority of your todo.\nUsage: %s", c.Command.UsageText))
 	}
 
-	collection, err := NewCollection()
+	collection, err := openCollection(c)
 	if err != nil {
 		return exitError(err)
 	}
+	defer helper.Check(collection.Close)
 
-	collection.Search(c.Args()[0])
+	id, err := collection.Resolve(c.Args()[0])
+	if err != nil {
+		return exitError(err)
+	}
 
-	if len(collection.Todos) == 0 {
-		ct.ChangeColor(ct.Cyan, false, ct.None, false)
-		fmt.Printf("Sorry, there's no todos containing \"%s\".\n", c.Args()[0])
-		ct.ResetColor()
-		return nil
+	todo, err := collection.Find(id)
+	if err != nil {
+		return exitError(err)
 	}
 
-	if len(collection.Todos) > 0 {
-		fmt.Println()
-		for _, todo := range collection.Todos {
-			todo.MakeOutput(true)
+	var level string
+	switch c.Args()[1] {
+	case "+":
+		level = BumpPriority(todo.Priority, true)
+	case "-":
+		level = BumpPriority(todo.Priority, false)
+	default:
+		if level, err = ParsePriority(c.Args()[1]); err != nil {
+			return exitError(err)
 		}
-		fmt.Println()
+	}
+
+	if _, err = collection.SetPriority(id, level); err != nil {
+		return exitError(err)
+	}
+
+	if err := collection.WriteTodos(); err != nil {
+		return exitError(err)
+	}
+
+	if level == "" {
+		printSucces("Your todo %d has no priority anymore.\n", id)
 	} else {
-		printSucces("There's no todo to show.")
+		printSucces("Your todo %d has now the priority %s.\n", id, level)
 	}
 	return nil
 }
 
-func reorder(c *cli.Context) error {
-	collection, err := NewCollection()
+func toggle(c *cli.Context) error {
+
+	if len(c.Args()) == 0 && c.String("where") == "" {
+		return exitError(
+			fmt.Errorf("You must provide the position of the item you want to change.\nUsage: %s", c.Command.UsageText))
+	}
+
+	collection, err := openCollection(c)
 	if err != nil {
 		return exitError(err)
 	}
+	defer helper.Check(collection.Close)
 
-	exact := c.Bool("exact")
-
-	if exact {
-		ids := make([]int64, len(c.Args()))
-		for i, sid := range c.Args() {
-			id, err := strconv.ParseInt(sid, 10, 32)
-			if err != nil {
-				return exitError(err)
-			}
-			ids[i] = id
-		}
-		if err := collection.ReorderByIDs(ids); err != nil {
-			return exitError(err)
-		}
+	ids, err := collection.Select(splitRefs(c.Args()), c.String("where"))
+	if err != nil {
+		return exitError(err)
 	}
 
-	if err := collection.Reorder(); err != nil {
+	count := len(collection.Todos)
+	todos, err := collection.ToggleAll(ids)
+	if err != nil {
 		return exitError(err)
 	}
 
@@ -184,48 +248,90 @@ func reorder(c *cli.Context) error {
 		return exitError(err)
 	}
 
-	printSucces("Your list is now reordered.")
+	printStatuses(todos)
+	printOccurrences(collection.Todos[count:])
 	return nil
+}
 
+// printStatuses prints the new status of todos
+func printStatuses(todos []*Todo) {
+	for _, todo := range todos {
+		status := "marked as " + todo.Status
+		if todo.Status == WIP {
+			status = "marked as work in progress"
+		}
+		printSucces("Your todo %d is now %s.\n", todo.ID, status)
+	}
 }
 
-func swap(c *cli.Context) error {
+// printOccurrences prints the next occurrences created by recurring todos done
+func printOccurrences(todos []*Todo) {
+	for _, next := range todos {
+		printSucces("The next occurrence #%d is due on %s.\n", next.ID, next.Due.Format(dateLayout))
+	}
+}
 
-	if len(c.Args()) != 2 {
+func block(c *cli.Context) error {
+
+	if len(c.Args()) != 1 || len(c.StringSlice("on")) == 0 {
 		return exitError(
-			fmt.Errorf("You must provide two position if you want to swap todos.\nUsage: %s", c.Command.UsageText))
+			fmt.Errorf("You must provide the id of your todo and the ids of the todos blocking it.\nUsage: %s", c.Command.UsageText))
 	}
 
-	collection, err := NewCollection()
+	collection, err := openCollection(c)
 	if err != nil {
 		return exitError(err)
 	}
+	defer helper.Check(collection.Close)
 
-	idA, err := strconv.ParseInt(c.Args()[0], 10, 32)
+	id, err := collection.Resolve(c.Args()[0])
 	if err != nil {
 		return exitError(err)
 	}
 
-	idB, err := strconv.ParseInt(c.Args()[1], 10, 32)
+	on, err := collection.ResolveAll(splitRefs(c.StringSlice("on")))
 	if err != nil {
 		return exitError(err)
 	}
 
-	_, err = collection.Find(idA)
+	todo, err := collection.Block(id, on)
 	if err != nil {
 		return exitError(err)
 	}
 
-	_, err = collection.Find(idB)
+	if err := collection.WriteTodos(); err != nil {
+		return exitError(err)
+	}
+
+	printSucces("Your todo %d is now blocked by %s.\n", id, joinIDs(todo.DependsOn))
+	return nil
+}
+
+func unblock(c *cli.Context) error {
+
+	if len(c.Args()) != 1 {
+		return exitError(
+			fmt.Errorf("You must provide the id of your todo.\nUsage: %s", c.Command.UsageText))
+	}
+
+	collection, err := openCollection(c)
 	if err != nil {
 		return exitError(err)
 	}
+	defer helper.Check(collection.Close)
 
-	if err := collection.Swap(idA, idB); err != nil {
+	id, err := collection.Resolve(c.Args()[0])
+	if err != nil {
 		return exitError(err)
 	}
 
-	if err := collection.Reorder(); err != nil {
+	on, err := collection.ResolveAll(splitRefs(c.StringSlice("on")))
+	if err != nil {
+		return exitError(err)
+	}
+
+	todo, err := collection.Unblock(id, on)
+	if err != nil {
 		return exitError(err)
 	}
 
@@ -233,29 +339,73 @@ func swap(c *cli.Context) error {
 		return exitError(err)
 	}
 
-	printSucces("\"%s\" and \"%s\" has been swapped\n", c.Args()[0], c.Args()[1])
+	if len(todo.DependsOn) == 0 {
+		printSucces("Your todo %d is not blocked anymore.\n", id)
+	} else {
+		printSucces("Your todo %d is still blocked by %s.\n", id, joinIDs(todo.DependsOn))
+	}
+	return nil
+}
 
+func next(c *cli.Context) error {
+	collection, err := NewCollectionWhere(db.Filter{ExcludedStatuses: finishedStatuses()})
+	if err != nil {
+		return exitError(err)
+	}
+	defer helper.Check(collection.Close)
+
+	collection.ListUndoneTodos()
+	if err := collection.ListActionableTodos(); err != nil {
+		return exitError(err)
+	}
+
+	if err := collection.Sort(c.String("sort")); err != nil {
+		return exitError(err)
+	}
+
+	if len(collection.Todos) == 0 {
+		ct.ChangeColor(ct.Yellow, false, ct.None, false)
+		fmt.Println("There's no todo ready to be done.")
+		ct.ResetColor()
+		return nil
+	}
+
+	fmt.Println()
+	for _, todo := range collection.Todos {
+		todo.MakeOutput(true)
+	}
+	fmt.Println()
 	return nil
 }
 
-func wip(c *cli.Context) error {
+func note(c *cli.Context) error {
 
-	if len(c.Args()) != 1 {
+	if len(c.Args()) != 2 {
 		return exitError(
-			fmt.Errorf("You must provide the position of the item you want to change.\nUsage: %s", c.Command.UsageText))
+			fmt.Errorf("You must provide the id of your todo and the text of the note.\nUsage: %s", c.Command.UsageText))
 	}
 
-	collection, err := NewCollection()
+	text := c.Args()[1]
+	if text == "-" {
+		content, err := ioutil.ReadAll(os.Stdin)
+		if err != nil {
+			return exitError(err)
+		}
+		text = string(content)
+	}
+
+	collection, err := openCollection(c)
 	if err != nil {
 		return exitError(err)
 	}
+	defer helper.Check(collection.Close)
 
-	id, err := strconv.ParseInt(c.Args()[0], 10, 32)
+	id, err := collection.Resolve(c.Args()[0])
 	if err != nil {
 		return exitError(err)
 	}
 
-	todo, err := collection.SetStatus(id, WIP)
+	todo, err := collection.AddNote(id, text)
 	if err != nil {
 		return exitError(err)
 	}
@@ -264,69 +414,1068 @@ func wip(c *cli.Context) error {
 		return exitError(err)
 	}
 
-	var status string
-	switch todo.Status {
-	case WIP:
-		status = "marked as work in progress"
-	default:
-		status = todo.Status
-	}
-
-	printSucces("Your todo %d is now %s.\n", id, status)
+	printSucces("Your todo %d has now %d notes.\n", id, len(todo.Notes))
 	return nil
 }
 
-func clean(c *cli.Context) error {
+func show(c *cli.Context) error {
 
-	collection, err := NewCollection()
+	if len(c.Args()) != 1 {
+		return exitError(
+			fmt.Errorf("You must provide the id of the todo to show.\nUsage: %s", c.Command.UsageText))
+	}
 
+	collection, id, err := collectionOf(c.Args()[0])
 	if err != nil {
 		return exitError(err)
 	}
+	defer helper.Check(collection.Close)
 
-	collection.RemoveFinishedTodos()
+	todo, err := collection.Find(id)
+	if err != nil {
+		return exitError(err)
+	}
 
-	if err := collection.WriteTodos(); err != nil {
+	blockers, err := collection.Blockers()
+	if err != nil {
 		return exitError(err)
 	}
 
-	printSucces("Your list is now flushed of finished todos.")
+	fmt.Println()
+	todo.MakeDetailedOutput(true, blockers[id])
+	fmt.Println()
 	return nil
 }
 
-func noSubcommands(c *cli.Context) error {
+// collectionOf returns the collection of the todo designated by ref, see
+// Resolve, with its ID. An ID only loads this todo from a store able to
+// query it, a UID prefix loads all the todos.
+func collectionOf(ref string) (*Collection, int64, error) {
+	if id, err := strconv.ParseInt(strings.TrimSpace(ref), 10, 32); err == nil {
+		collection, err := NewCollectionWhere(db.Filter{IDs: []int64{id}})
+		if err != nil {
+			return nil, 0, err
+		}
+		if _, err := collection.Find(id); err == nil {
+			return collection, id, nil
+		}
+		helper.Check(collection.Close)
+	}
 
-	collection, err := NewCollection()
+	collection, err := NewCollectionWhere(db.Filter{})
 	if err != nil {
-		return exitError(err)
+		return nil, 0, err
+	}
+	id, err := collection.Resolve(ref)
+	if err != nil {
+		helper.Check(collection.Close)
+		return nil, 0, err
 	}
+	return collection, id, nil
+}
 
-	if !c.IsSet("all") {
-		switch {
-		case c.IsSet("done"):
-			collection.ListDoneTodos()
-		case c.IsSet("wip"):
-			collection.ListWorkInProgressTodos()
-		default:
-			collection.ListUndoneTodos()
-		}
+func history(c *cli.Context) error {
+
+	if len(c.Args()) > 1 {
+		return exitError(
+			fmt.Errorf("You must provide at most the id of one todo.\nUsage: %s", c.Command.UsageText))
 	}
 
-	if len(collection.Todos) > 0 {
-		fmt.Println()
-		for _, todo := range collection.Todos {
-			todo.MakeOutput(true)
+	var since time.Time
+	if c.String("since") != "" {
+		var err error
+		if since, err = ParseSince(c.String("since"), time.Now()); err != nil {
+			return exitError(err)
 		}
-		fmt.Println()
+	}
 
+	var collection *Collection
+	var id int64
+	var err error
+	if len(c.Args()) == 1 {
+		collection, id, err = collectionOf(c.Args()[0])
 	} else {
+		collection, err = NewCollectionWhere(db.Filter{})
+	}
+	if err != nil {
+		return exitError(err)
+	}
+	defer helper.Check(collection.Close)
+
+	if id != 0 {
+		todo, _ := collection.Find(id)
+		collection.Todos = []*Todo{todo}
+	}
+
+	events := collection.History(since)
+	if len(events) == 0 {
 		ct.ChangeColor(ct.Yellow, false, ct.None, false)
-		fmt.Println("There's no todo to show.")
+		fmt.Println("There's no change to show.")
+		ct.ResetColor()
+		return nil
+	}
+
+	fmt.Println()
+	if id != 0 {
+		collection.Todos[0].MakeOutput(true)
+		fmt.Println()
+	}
+	for _, event := range events {
+		ct.ChangeColor(ct.Cyan, false, ct.None, false)
+		fmt.Print("  ", event.Date.Local().Format(timeLayout))
 		ct.ResetColor()
+		fmt.Printf("  %-10s ", orNone(event.Author))
+		if id == 0 {
+			fmt.Printf("#%d %s: ", event.Todo.ID, event.Todo.Desc)
+		}
+		fmt.Println(event)
+	}
+	fmt.Println()
+	return nil
+}
+
+func undo(c *cli.Context) error {
+	return replay(c, (*db.Journal).Undo, "Undone")
+}
+
+func redo(c *cli.Context) error {
+	return replay(c, (*db.Journal).Redo, "Redone")
+}
+
+// replay undoes or redoes a command of the journal
+func replay(c *cli.Context, apply func(j *db.Journal, store db.Store) (db.Entry, error), done string) error {
+	ds, err := db.NewDataStore()
+	if err != nil {
+		return exitError(err)
+	}
+	store, err := ds.Store()
+	if err != nil {
+		return exitError(err)
 	}
+	if err := store.Lock(); err != nil {
+		return exitError(err)
+	}
+	defer helper.Check(store.Unlock)
+
+	journal, err := db.OpenJournal(store)
+	if err != nil {
+		return exitError(err)
+	}
+	entry, err := apply(journal, store)
+	if err != nil {
+		return exitError(err)
+	}
+
+	printSucces("%s: %s\n", done, entry.Command)
 	return nil
 }
 
+func showJournal(c *cli.Context) error {
+	ds, err := db.NewDataStore()
+	if err != nil {
+		return exitError(err)
+	}
+	store, err := ds.Store()
+	if err != nil {
+		return exitError(err)
+	}
+	if err := store.Lock(); err != nil {
+		return exitError(err)
+	}
+	defer helper.Check(store.Unlock)
+
+	journal, err := db.OpenJournal(store)
+	if err != nil {
+		return exitError(err)
+	}
+
+	if len(journal.Entries) == 0 {
+		ct.ChangeColor(ct.Yellow, false, ct.None, false)
+		fmt.Println("The journal is empty.")
+		ct.ResetColor()
+		return nil
+	}
+
+	fmt.Println()
+	for i := len(journal.Entries) - 1; i >= 0; i-- {
+		entry := journal.Entries[i]
+		undone := i >= len(journal.Entries)-journal.Undone
+		if undone {
+			ct.ChangeColor(ct.Black, true, ct.None, false)
+		}
+		fmt.Printf("  %s  %s", entry.Date.Local().Format(timeLayout), entry.Command)
+		if undone {
+			fmt.Print(" (undone)")
+			ct.ResetColor()
+		}
+		fmt.Println()
+	}
+	fmt.Println()
+	return nil
+}
+
+func search(c *cli.Context) error {
+	if len(c.Args()) == 0 {
+		return exitError(
+			fmt.Errorf("You must provide a string search.\nUsage: %s", c.Command.UsageText))
+	}
+
+	var mode string
+	for _, flag := range []string{SearchRegex, SearchWord, SearchFuzzy} {
+		if c.Bool(flag) {
+			if mode != "" {
+				return exitError(fmt.Errorf("You can't search with both --%s and --%s.", mode, flag))
+			}
+			mode = flag
+		}
+	}
+
+	text := strings.Join(c.Args(), " ")
+	var query Query
+	var matcher Matcher
+	var err error
+	filter := db.Filter{}
+	if mode == "" {
+		if query, err = ParseQuery(text, time.Now()); err != nil {
+			return exitError(queryError(err))
+		}
+		filter = db.Filter{Text: filterText(query), Notes: c.Bool("notes")}
+	} else if matcher, err = NewMatcher(mode, text); err != nil {
+		return exitError(err)
+	}
+
+	collection, err := NewCollectionWhere(filter)
+	if err != nil {
+		return exitError(err)
+	}
+	defer helper.Check(collection.Close)
+
+	if query != nil {
+		if err := collection.Query(query, c.Bool("notes")); err != nil {
+			return exitError(err)
+		}
+	}
+	if err := collection.Sort(c.String("sort")); err != nil {
+		return exitError(err)
+	}
+	if matcher != nil {
+		// the best matches first, then in the order of --sort
+		collection.SearchMatching(matcher, c.Bool("notes"))
+	}
+
+	if len(collection.Todos) == 0 {
+		ct.ChangeColor(ct.Cyan, false, ct.None, false)
+		fmt.Printf("Sorry, there's no todos matching \"%s\".\n", text)
+		ct.ResetColor()
+		return nil
+	}
+
+	if len(collection.Todos) > 0 {
+		fmt.Println()
+		for _, todo := range collection.Todos {
+			todo.MakeOutput(true)
+		}
+		fmt.Println()
+	} else {
+		printSucces("There's no todo to show.")
+	}
+	return nil
+}
+
+func tags(c *cli.Context) error {
+	filter := db.Filter{ExcludedStatuses: finishedStatuses()}
+	if c.Bool("all") {
+		filter = db.Filter{}
+	}
+
+	collection, err := NewCollectionWhere(filter)
+	if err != nil {
+		return exitError(err)
+	}
+	defer helper.Check(collection.Close)
+
+	if !c.Bool("all") {
+		collection.ListUndoneTodos()
+	}
+
+	counts := collection.Tags()
+	if len(counts) == 0 {
+		printSucces("There's no tag to show.\n")
+		return nil
+	}
+
+	names := make([]string, 0, len(counts))
+	width := 0
+	for tag := range counts {
+		names = append(names, tag)
+		if len(tag) > width {
+			width = len(tag)
+		}
+	}
+	sort.Slice(names, func(i, j int) bool {
+		if counts[names[i]] != counts[names[j]] {
+			return counts[names[i]] > counts[names[j]]
+		}
+		return names[i] < names[j]
+	})
+
+	fmt.Println()
+	for _, tag := range names {
+		ct.ChangeColor(ct.Yellow, false, ct.None, false)
+		fmt.Printf("  #%-*s", width, tag)
+		ct.ResetColor()
+		fmt.Printf("  %d\n", counts[tag])
+	}
+	fmt.Println()
+	return nil
+}
+
+func projects(c *cli.Context) error {
+	collection, err := openCollection(c)
+	if err != nil {
+		return exitError(err)
+	}
+	defer helper.Check(collection.Close)
+
+	counts := collection.Projects()
+	delete(counts, "")
+	if len(counts) == 0 {
+		printSucces("There's no project to show.\n")
+		return nil
+	}
+
+	names, _ := collection.GroupByProject()
+	width := 0
+	for _, name := range names {
+		if len(name) > width {
+			width = len(name)
+		}
+	}
+
+	fmt.Println()
+	fmt.Printf("  %-*s  %7s  %7s  %7s\n", width+1, "", PENDING, "started", DONE)
+	for _, name := range names {
+		if name == "" {
+			continue
+		}
+		ct.ChangeColor(ct.Cyan, false, ct.None, false)
+		fmt.Printf("  +%-*s", width, name)
+		ct.ResetColor()
+		count := counts[name]
+		fmt.Printf("  %7d  %7d  %7d\n", count.Pending, count.Started, count.Done)
+	}
+	fmt.Println()
+	return nil
+}
+
+func reorder(c *cli.Context) error {
+	collection, err := openCollection(c)
+	if err != nil {
+		return exitError(err)
+	}
+	defer helper.Check(collection.Close)
+
+	exact := c.Bool("exact")
+
+	if exact {
+		ids, err := collection.ResolveAll(c.Args())
+		if err != nil {
+			return exitError(err)
+		}
+		if err := collection.ReorderByIDs(ids); err != nil {
+			return exitError(err)
+		}
+	}
+
+	if err := collection.Reorder(); err != nil {
+		return exitError(err)
+	}
+
+	if err := collection.WriteTodos(); err != nil {
+		return exitError(err)
+	}
+
+	printSucces("Your list is now reordered.")
+	return nil
+
+}
+
+func swap(c *cli.Context) error {
+
+	if len(c.Args()) != 2 {
+		return exitError(
+			fmt.Errorf("You must provide two position if you want to swap todos.\nUsage: %s", c.Command.UsageText))
+	}
+
+	collection, err := openCollection(c)
+	if err != nil {
+		return exitError(err)
+	}
+	defer helper.Check(collection.Close)
+
+	idA, err := collection.Resolve(c.Args()[0])
+	if err != nil {
+		return exitError(err)
+	}
+
+	idB, err := collection.Resolve(c.Args()[1])
+	if err != nil {
+		return exitError(err)
+	}
+
+	_, err = collection.Find(idA)
+	if err != nil {
+		return exitError(err)
+	}
+
+	_, err = collection.Find(idB)
+	if err != nil {
+		return exitError(err)
+	}
+
+	if err := collection.Swap(idA, idB); err != nil {
+		return exitError(err)
+	}
+
+	if err := collection.Reorder(); err != nil {
+		return exitError(err)
+	}
+
+	if err := collection.WriteTodos(); err != nil {
+		return exitError(err)
+	}
+
+	printSucces("\"%s\" and \"%s\" has been swapped\n", c.Args()[0], c.Args()[1])
+
+	return nil
+}
+
+func wip(c *cli.Context) error {
+
+	if err := requireWIP(); err != nil {
+		return exitError(err)
+	}
+	if len(c.Args()) == 0 && c.String("where") == "" {
+		return exitError(
+			fmt.Errorf("You must provide the position of the item you want to change.\nUsage: %s", c.Command.UsageText))
+	}
+
+	collection, err := openCollection(c)
+	if err != nil {
+		return exitError(err)
+	}
+	defer helper.Check(collection.Close)
+
+	ids, err := collection.Select(splitRefs(c.Args()), c.String("where"))
+	if err != nil {
+		return exitError(err)
+	}
+
+	todos, err := collection.SetStatusAll(ids, WIP)
+	if err != nil {
+		return exitError(err)
+	}
+
+	if err := collection.WriteTodos(); err != nil {
+		return exitError(err)
+	}
+
+	printStatuses(todos)
+	return nil
+}
+
+func status(c *cli.Context) error {
+	if len(c.Args()) == 0 || (len(c.Args()) == 1 && c.String("where") == "") {
+		return exitError(
+			fmt.Errorf("You must provide the id of the todo and its new status: %s.\nUsage: %s", statusNames(), c.Command.UsageText))
+	}
+	refs, status := c.Args()[:len(c.Args())-1], strings.ToLower(c.Args()[len(c.Args())-1])
+
+	collection, err := openCollection(c)
+	if err != nil {
+		return exitError(err)
+	}
+	defer helper.Check(collection.Close)
+
+	ids, err := collection.Select(splitRefs(refs), c.String("where"))
+	if err != nil {
+		return exitError(err)
+	}
+
+	count := len(collection.Todos)
+	todos, err := collection.SetStatusAll(ids, status)
+	if err != nil {
+		return exitError(err)
+	}
+
+	if err := collection.WriteTodos(); err != nil {
+		return exitError(err)
+	}
+
+	printStatuses(todos)
+	printOccurrences(collection.Todos[count:])
+	return nil
+}
+
+func done(c *cli.Context) error {
+	return mark(c, (*Collection).MarkDone, doneStatus())
+}
+
+func pending(c *cli.Context) error {
+	return mark(c, (*Collection).MarkPending, initialStatus())
+}
+
+// mark changes the status of the todos selected with one of the Mark methods,
+// the todos already in this status are reported without error
+func mark(c *cli.Context, apply func(*Collection, []int64) ([]*Todo, []*Todo, error), name string) error {
+
+	if len(c.Args()) == 0 && c.String("where") == "" {
+		return exitError(
+			fmt.Errorf("You must provide the position of the item you want to change.\nUsage: %s", c.Command.UsageText))
+	}
+
+	collection, err := openCollection(c)
+	if err != nil {
+		return exitError(err)
+	}
+	defer helper.Check(collection.Close)
+
+	ids, err := collection.Select(splitRefs(c.Args()), c.String("where"))
+	if err != nil {
+		return exitError(err)
+	}
+
+	count := len(collection.Todos)
+	todos, already, err := apply(collection, ids)
+	if err != nil {
+		return exitError(err)
+	}
+
+	if len(todos) > 0 {
+		if err := collection.WriteTodos(); err != nil {
+			return exitError(err)
+		}
+	}
+
+	for _, todo := range already {
+		printSucces("Your todo %d is already %s.\n", todo.ID, name)
+	}
+	printStatuses(todos)
+	printOccurrences(collection.Todos[count:])
+	return nil
+}
+
+func remove(c *cli.Context) error {
+
+	if len(c.Args()) == 0 && c.String("where") == "" {
+		return exitError(
+			fmt.Errorf("You must provide the ids of the todos to remove.\nUsage: %s", c.Command.UsageText))
+	}
+
+	collection, err := openCollection(c)
+	if err != nil {
+		return exitError(err)
+	}
+	defer helper.Check(collection.Close)
+
+	ids, err := collection.Select(splitRefs(c.Args()), c.String("where"))
+	if err != nil {
+		return exitError(err)
+	}
+
+	todos, err := collection.Remove(ids)
+	if err != nil {
+		return exitError(err)
+	}
+
+	if err := collection.WriteTodos(); err != nil {
+		return exitError(err)
+	}
+
+	for _, todo := range todos {
+		printSucces("#%d \"%s\" is removed.\n", todo.ID, todo.Desc)
+	}
+	return nil
+}
+
+func clean(c *cli.Context) error {
+
+	collection, err := openCollection(c)
+	if err != nil {
+		return exitError(err)
+	}
+	defer helper.Check(collection.Close)
+
+	var before time.Time
+	if c.String("older-than") != "" {
+		if before, err = ParseSince(c.String("older-than"), time.Now()); err != nil {
+			return exitError(err)
+		}
+	}
+
+	removed := collection.RemoveTodosDoneBefore(before)
+	if err := collection.Archive(removed); err != nil {
+		return exitError(err)
+	}
+
+	if err := collection.WriteTodos(); err != nil {
+		return exitError(err)
+	}
+
+	switch {
+	case len(removed) == 0:
+		printSucces("There's no finished todo to archive.\n")
+	case before.IsZero():
+		printSucces("Your list is now flushed of finished todos, they are kept in the archive.\n")
+	default:
+		printSucces("%d finished todos moved to the archive.\n", len(removed))
+	}
+	return nil
+}
+
+func archiveList(c *cli.Context) error {
+	return showArchive(c, "")
+}
+
+func archiveSearch(c *cli.Context) error {
+	if len(c.Args()) == 0 {
+		return exitError(
+			fmt.Errorf("You must provide a string search.\nUsage: %s", c.Command.UsageText))
+	}
+	return showArchive(c, strings.Join(c.Args(), " "))
+}
+
+// showArchive prints the archived todos matching a query, or all of them
+func showArchive(c *cli.Context, text string) error {
+
+	query, err := ParseQuery(text, time.Now())
+	if err != nil {
+		return exitError(queryError(err))
+	}
+
+	collection, err := NewCollectionWhere(db.Filter{})
+	if err != nil {
+		return exitError(err)
+	}
+	defer helper.Check(collection.Close)
+
+	if collection.Todos, err = collection.Archived(); err != nil {
+		return exitError(err)
+	}
+	if err := collection.Query(query, true); err != nil {
+		return exitError(err)
+	}
+
+	if len(collection.Todos) == 0 {
+		ct.ChangeColor(ct.Cyan, false, ct.None, false)
+		if text != "" {
+			fmt.Printf("Sorry, there's no archived todos matching \"%s\".\n", text)
+		} else {
+			fmt.Println("The archive is empty.")
+		}
+		ct.ResetColor()
+		return nil
+	}
+
+	fmt.Println()
+	for _, todo := range collection.Todos {
+		todo.MakeArchivedOutput(true)
+	}
+	fmt.Println()
+	return nil
+}
+
+func archiveRestore(c *cli.Context) error {
+	if len(c.Args()) != 1 {
+		return exitError(
+			fmt.Errorf("You must provide the UID of the archived todo.\nUsage: %s", c.Command.UsageText))
+	}
+
+	collection, err := openCollection(c)
+	if err != nil {
+		return exitError(err)
+	}
+	defer helper.Check(collection.Close)
+
+	todo, err := collection.Restore(c.Args()[0])
+	if err != nil {
+		return exitError(err)
+	}
+
+	if err := collection.WriteTodos(); err != nil {
+		return exitError(err)
+	}
+
+	printSucces("Your todo is back with the id %d.\n", todo.ID)
+	return nil
+}
+
+func noSubcommands(c *cli.Context) error {
+
+	// the flags choosing the todos replace the default view
+	filtered := false
+	for _, flag := range []string{"done", "wip", "all", "overdue", "due-before", "tag", "not-tag", "project"} {
+		filtered = filtered || c.IsSet(flag)
+	}
+	if !filtered {
+		views, err := new(Collection).Views()
+		if err != nil {
+			return exitError(err)
+		}
+		if views.Default != "" {
+			query, ok := views.Queries[views.Default]
+			if !ok {
+				return exitError(fmt.Errorf("The default view %s doesn't exist anymore, see td view default.", views.Default))
+			}
+			return listQuery(c, query, false)
+		}
+	}
+
+	var filter db.Filter
+	if !c.IsSet("all") {
+		switch {
+		case c.IsSet("done"):
+			filter.Statuses = finishedStatuses()
+		case c.IsSet("wip"):
+			if err := requireWIP(); err != nil {
+				return exitError(err)
+			}
+			filter.Statuses = []string{WIP}
+		default:
+			filter.ExcludedStatuses = finishedStatuses()
+		}
+	}
+
+	collection, err := NewCollectionWhere(filter)
+	if err != nil {
+		return exitError(err)
+	}
+	defer helper.Check(collection.Close)
+
+	progress, err := collection.Progress()
+	if err != nil {
+		return exitError(err)
+	}
+	blockers, err := collection.Blockers()
+	if err != nil {
+		return exitError(err)
+	}
+
+	if !c.IsSet("all") {
+		switch {
+		case c.IsSet("done"):
+			collection.ListDoneTodos()
+		case c.IsSet("wip"):
+			collection.ListWorkInProgressTodos()
+		default:
+			collection.ListUndoneTodos()
+		}
+	}
+
+	if c.IsSet("overdue") {
+		collection.ListOverdueTodos()
+	}
+	if c.IsSet("due-before") {
+		date, err := ParseDate(c.String("due-before"), time.Now())
+		if err != nil {
+			return exitError(err)
+		}
+		collection.ListDueBefore(date)
+	}
+
+	collection.ListTagged(c.StringSlice("tag"))
+	collection.ListNotTagged(c.StringSlice("not-tag"))
+	if c.IsSet("project") {
+		collection.ListProject(c.String("project"))
+	}
+
+	return printList(c, collection, progress, blockers)
+}
+
+func list(c *cli.Context) error {
+	return listQuery(c, strings.Join(c.Args(), " "), c.Bool("all"))
+}
+
+// listQuery prints the todos matching a query, the finished ones only when
+// the query is about the status or all is set
+func listQuery(c *cli.Context, text string, all bool) error {
+
+	query, err := ParseQuery(text, time.Now())
+	if err != nil {
+		return exitError(queryError(err))
+	}
+
+	collection, err := NewCollectionWhere(db.Filter{})
+	if err != nil {
+		return exitError(err)
+	}
+	defer helper.Check(collection.Close)
+
+	progress, err := collection.Progress()
+	if err != nil {
+		return exitError(err)
+	}
+	blockers, err := collection.Blockers()
+	if err != nil {
+		return exitError(err)
+	}
+
+	if !all && !aboutStatus(query) {
+		collection.ListUndoneTodos()
+	}
+	if err := collection.Query(query, false); err != nil {
+		return exitError(err)
+	}
+
+	return printList(c, collection, progress, blockers)
+}
+
+func view(c *cli.Context) error {
+	if len(c.Args()) != 1 {
+		return exitError(
+			fmt.Errorf("You must provide the name of a view.\nUsage: %s", c.Command.UsageText))
+	}
+
+	views, err := new(Collection).Views()
+	if err != nil {
+		return exitError(err)
+	}
+	query, ok := views.Queries[c.Args()[0]]
+	if !ok {
+		return exitError(fmt.Errorf("There's no view named %s, see td view list.", c.Args()[0]))
+	}
+	return listQuery(c, query, false)
+}
+
+func viewSave(c *cli.Context) error {
+	if len(c.Args()) < 2 {
+		return exitError(
+			fmt.Errorf("You must provide the name of the view and its query.\nUsage: %s", c.Command.UsageText))
+	}
+
+	err := new(Collection).EditViews(func(views *db.Views) error {
+		return SaveView(views, c.Args()[0], strings.Join(c.Args()[1:], " "))
+	})
+	if err != nil {
+		return exitError(err)
+	}
+
+	printSucces("The view %s is saved, run it with td view %s.\n", c.Args()[0], c.Args()[0])
+	return nil
+}
+
+func viewList(c *cli.Context) error {
+
+	views, err := new(Collection).Views()
+	if err != nil {
+		return exitError(err)
+	}
+	if len(views.Queries) == 0 {
+		ct.ChangeColor(ct.Yellow, false, ct.None, false)
+		fmt.Println("There's no view, save one with td view save.")
+		ct.ResetColor()
+		return nil
+	}
+
+	var names []string
+	width := 0
+	for name := range views.Queries {
+		names = append(names, name)
+		if len(name) > width {
+			width = len(name)
+		}
+	}
+	sort.Strings(names)
+
+	fmt.Println()
+	for _, name := range names {
+		ct.ChangeColor(ct.Cyan, false, ct.None, false)
+		fmt.Printf("  %-*s", width, name)
+		ct.ResetColor()
+		fmt.Print("  ", views.Queries[name])
+		if name == views.Default {
+			ct.ChangeColor(ct.Yellow, false, ct.None, false)
+			fmt.Print(" (default)")
+			ct.ResetColor()
+		}
+		fmt.Println()
+	}
+	fmt.Println()
+	return nil
+}
+
+func viewRemove(c *cli.Context) error {
+	if len(c.Args()) != 1 {
+		return exitError(
+			fmt.Errorf("You must provide the name of the view.\nUsage: %s", c.Command.UsageText))
+	}
+
+	err := new(Collection).EditViews(func(views *db.Views) error {
+		return RemoveView(views, c.Args()[0])
+	})
+	if err != nil {
+		return exitError(err)
+	}
+
+	printSucces("The view %s is removed.\n", c.Args()[0])
+	return nil
+}
+
+func viewDefault(c *cli.Context) error {
+	if len(c.Args()) != 1 {
+		return exitError(
+			fmt.Errorf("You must provide the name of the view, or none.\nUsage: %s", c.Command.UsageText))
+	}
+
+	var name string
+	err := new(Collection).EditViews(func(views *db.Views) error {
+		err := SetDefaultView(views, c.Args()[0])
+		name = views.Default
+		return err
+	})
+	if err != nil {
+		return exitError(err)
+	}
+
+	if name == "" {
+		printSucces("td lists the todos not done again.\n")
+	} else {
+		printSucces("td now lists the view %s.\n", name)
+	}
+	return nil
+}
+
+// queryError shows where a query is wrong
+func queryError(err error) error {
+	if queryErr, ok := err.(*QueryError); ok {
+		return errors.New(queryErr.Detail())
+	}
+	return err
+}
+
+// printList prints the todos sorted by --sort, as a tree or grouped by
+// project with --group
+func printList(c *cli.Context, collection *Collection, progress map[int64]Progress, blockers map[int64][]int64) error {
+	if err := collection.Sort(c.String("sort")); err != nil {
+		return exitError(err)
+	}
+
+	if len(collection.Todos) > 0 && c.Bool("group") {
+		names, groups := collection.GroupByProject()
+		for _, name := range names {
+			fmt.Println()
+			printProjectHeading(name)
+			for _, todo := range groups[name] {
+				todo.MakeTreeOutput(true, 0, progress[todo.ID], blockers[todo.ID])
+			}
+		}
+		fmt.Println()
+
+	} else if len(collection.Todos) > 0 {
+		fmt.Println()
+		for _, node := range collection.Tree() {
+			node.Todo.MakeTreeOutput(true, node.Depth, progress[node.Todo.ID], blockers[node.Todo.ID])
+		}
+		fmt.Println()
+
+	} else {
+		ct.ChangeColor(ct.Yellow, false, ct.None, false)
+		fmt.Println("There's no todo to show.")
+		ct.ResetColor()
+	}
+	return nil
+}
+
+func migrate(c *cli.Context) error {
+	format := c.String("to")
+	if format == "" {
+		return exitError(
+			fmt.Errorf("You must provide the format to convert your todos to.\nUsage: %s", c.Command.UsageText))
+	}
+
+	ds, err := db.NewDataStore()
+	if err != nil {
+		return exitError(err)
+	}
+	if strings.Contains(ds.Path, "://") {
+		return exitError(fmt.Errorf("Only a file can be converted, set %s to a file path", db.EnvDBPath))
+	}
+
+	store, err := ds.Store()
+	if err != nil {
+		return exitError(err)
+	}
+	if err := store.Lock(); err != nil {
+		return exitError(err)
+	}
+	defer helper.Check(store.Unlock)
+
+	backup, err := db.Convert(ds.Path, format)
+	if err != nil {
+		return exitError(err)
+	}
+
+	printSucces("Your todos are now stored as %s, the previous file is kept as \"%s\".\n", format, backup)
+	return nil
+}
+
+// openCollection returns all the todos, recording the changes the command
+// writes in the journal
+func openCollection(c *cli.Context) (*Collection, error) {
+	collection, err := NewCollection()
+	if err != nil {
+		return nil, err
+	}
+	collection.Command = commandLine(os.Args[1:])
+	return collection, nil
+}
+
+// commandLine writes the arguments of td like they were typed
+func commandLine(args []string) string {
+	quoted := make([]string, len(args))
+	for i, arg := range args {
+		if arg == "" || strings.ContainsAny(arg, " \t\n\"'") {
+			arg = strconv.Quote(arg)
+		}
+		quoted[i] = arg
+	}
+	return "td " + strings.Join(quoted, " ")
+}
+
+// splitRefs reads the references to todos given as repeated or comma
+// separated values
+func splitRefs(values []string) []string {
+	var refs []string
+	for _, value := range values {
+		for _, ref := range strings.Split(value, ",") {
+			if ref = strings.TrimSpace(ref); ref != "" {
+				refs = append(refs, ref)
+			}
+		}
+	}
+	return refs
+}
+
+// joinIDs writes IDs like "4, 7"
+func joinIDs(ids []int64) string {
+	sids := make([]string, len(ids))
+	for i, id := range ids {
+		sids[i] = strconv.FormatInt(id, 10)
+	}
+	return strings.Join(sids, ", ")
+}
+
+// printProjectHeading print the name of a project above its todos
+func printProjectHeading(name string) {
+	ct.ChangeColor(ct.Cyan, true, ct.None, false)
+	if name == "" {
+		fmt.Println("No project")
+	} else {
+		fmt.Println("+" + name)
+	}
+	ct.ResetColor()
+}
+
 func printSucces(format string, a ...interface{}) {
 	ct.ChangeColor(ct.Cyan, false, ct.None, false)
 	fmt.Printf(format, a...)
@@ -0,0 +1,112 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// dateLayout is the layout of the ISO dates accepted and printed by td
+const dateLayout = "2006-01-02"
+
+var weekdays = map[string]time.Weekday{
+	"sun": time.Sunday, "sunday": time.Sunday,
+	"mon": time.Monday, "monday": time.Monday,
+	"tue": time.Tuesday, "tuesday": time.Tuesday,
+	"wed": time.Wednesday, "wednesday": time.Wednesday,
+	"thu": time.Thursday, "thursday": time.Thursday,
+	"fri": time.Friday, "friday": time.Friday,
+	"sat": time.Saturday, "saturday": time.Saturday,
+}
+
+// ParseDate reads a day relative to now. It accepts ISO dates (2018-06-01),
+// "today", "tomorrow", "yesterday", weekdays ("fri", "next monday": the next
+// one after today), offsets ("+3d", "+2w", "+1m") and "eow"/"eom" for the end
+// of the week (sunday) and of the month. The result is midnight of that day.
+func ParseDate(value string, now time.Time) (time.Time, error) {
+	value = strings.ToLower(strings.TrimSpace(value))
+	today := day(now)
+
+	switch value {
+	case "today":
+		return today, nil
+	case "tomorrow":
+		return today.AddDate(0, 0, 1), nil
+	case "yesterday":
+		return today.AddDate(0, 0, -1), nil
+	case "eow":
+		return today.AddDate(0, 0, (7-int(today.Weekday()))%7), nil
+	case "eom":
+		return time.Date(today.Year(), today.Month()+1, 0, 0, 0, 0, 0, today.Location()), nil
+	}
+
+	if weekday, ok := weekdays[strings.TrimPrefix(value, "next ")]; ok {
+		days := (int(weekday)-int(today.Weekday())+6)%7 + 1
+		return today.AddDate(0, 0, days), nil
+	}
+
+	if strings.HasPrefix(value, "+") && len(value) > 2 {
+		count, err := strconv.Atoi(value[1 : len(value)-1])
+		if err == nil && count >= 0 {
+			switch value[len(value)-1] {
+			case 'd':
+				return today.AddDate(0, 0, count), nil
+			case 'w':
+				return today.AddDate(0, 0, 7*count), nil
+			case 'm':
+				return addMonths(today, count), nil
+			}
+		}
+	}
+
+	date, err := time.ParseInLocation(dateLayout, value, now.Location())
+	if err != nil {
+		return time.Time{}, fmt.Errorf("\"%s\" is not a date: use YYYY-MM-DD, today, tomorrow, a weekday, +3d, +2w, +1m, eow or eom", value)
+	}
+	return date, nil
+}
+
+// addMonths returns the same day count months later, or the last day of the
+// month when it is shorter: +1m from January 31 is the last day of February
+func addMonths(t time.Time, count int) time.Time {
+	// the day 0 of the month after is the last day of the month
+	last := time.Date(t.Year(), t.Month()+time.Month(count)+1, 0, t.Hour(), t.Minute(), t.Second(), t.Nanosecond(), t.Location())
+	if t.Day() > last.Day() {
+		return last
+	}
+	return time.Date(last.Year(), last.Month(), t.Day(), t.Hour(), t.Minute(), t.Second(), t.Nanosecond(), t.Location())
+}
+
+// day returns midnight of the day of t
+func day(t time.Time) time.Time {
+	return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, t.Location())
+}
+
+// daysBetween returns the number of days from the day of a to the day of b
+func daysBetween(a time.Time, b time.Time) int {
+	a, b = day(a), day(b)
+	// dates at noon UTC are not affected by daylight saving time changes
+	from := time.Date(a.Year(), a.Month(), a.Day(), 12, 0, 0, 0, time.UTC)
+	to := time.Date(b.Year(), b.Month(), b.Day(), 12, 0, 0, 0, time.UTC)
+	return int(to.Sub(from).Hours() / 24)
+}
+
+// dueText describes a due date relative to now
+func dueText(due time.Time, now time.Time) string {
+	days := daysBetween(now, due)
+	switch {
+	case days == 0:
+		return "due today"
+	case days == 1:
+		return "due tomorrow"
+	case days == -1:
+		return "overdue by 1 day"
+	case days < 0:
+		return fmt.Sprintf("overdue by %d days", -days)
+	case days < 7:
+		return fmt.Sprintf("due in %d days", days)
+	default:
+		return "due " + due.Format(dateLayout)
+	}
+}
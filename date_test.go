@@ -0,0 +1,99 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseDate(t *testing.T) {
+	// a friday
+	now := time.Date(2018, 5, 25, 15, 30, 0, 0, time.UTC)
+	cases := map[string]string{
+		"2018-06-01": "2018-06-01",
+		"today":      "2018-05-25",
+		"Tomorrow":   "2018-05-26",
+		"yesterday":  "2018-05-24",
+		"fri":        "2018-06-01",
+		"sat":        "2018-05-26",
+		"next mon":   "2018-05-28",
+		"thursday":   "2018-05-31",
+		"+3d":        "2018-05-28",
+		"+2w":        "2018-06-08",
+		"+1m":        "2018-06-25",
+		"+0d":        "2018-05-25",
+		"eow":        "2018-05-27",
+		"eom":        "2018-05-31",
+	}
+	for value, expected := range cases {
+		date, err := ParseDate(value, now)
+		if err != nil {
+			t.Errorf("%s: %s", value, err)
+			continue
+		}
+		if date.Format(dateLayout) != expected || date.Hour() != 0 {
+			t.Errorf("Expected \"%s\" to be %s, got %s", value, expected, date)
+		}
+	}
+
+	for _, value := range []string{"", "someday", "+3y", "+d", "2018-13-01"} {
+		if _, err := ParseDate(value, now); err == nil {
+			t.Errorf("Expected \"%s\" not to be a date", value)
+		}
+	}
+}
+
+func TestParseDateAtMonthEnd(t *testing.T) {
+	cases := map[string]string{
+		"2019-01-31": "2019-02-28",
+		"2020-01-31": "2020-02-29",
+		"2018-08-31": "2018-09-30",
+	}
+	for today, expected := range cases {
+		now, _ := time.Parse(dateLayout, today)
+		if date, _ := ParseDate("+1m", now); date.Format(dateLayout) != expected {
+			t.Errorf("Expected +1m from %s to be %s, got %s", today, expected, date.Format(dateLayout))
+		}
+	}
+	now, _ := time.Parse(dateLayout, "2019-03-31")
+	if since, _ := ParseSince("1m", now); since.Format(dateLayout) != "2019-02-28" {
+		t.Errorf("Expected 1m back from 2019-03-31 to be 2019-02-28, got %s", since.Format(dateLayout))
+	}
+}
+
+func TestEndOfWeekOnSunday(t *testing.T) {
+	sunday := time.Date(2018, 5, 27, 9, 0, 0, 0, time.UTC)
+	date, _ := ParseDate("eow", sunday)
+	if date.Format(dateLayout) != "2018-05-27" {
+		t.Errorf("Expected the end of the week to be today on sunday, got %s", date)
+	}
+}
+
+func TestDueText(t *testing.T) {
+	now := time.Date(2018, 5, 25, 23, 59, 0, 0, time.UTC)
+	cases := map[string]string{
+		"2018-05-25": "due today",
+		"2018-05-26": "due tomorrow",
+		"2018-05-29": "due in 4 days",
+		"2018-06-10": "due 2018-06-10",
+		"2018-05-24": "overdue by 1 day",
+		"2018-05-20": "overdue by 5 days",
+	}
+	for date, expected := range cases {
+		due, _ := time.Parse(dateLayout, date)
+		if text := dueText(due, now); text != expected {
+			t.Errorf("Expected \"%s\" for %s, got \"%s\"", expected, date, text)
+		}
+	}
+}
+
+func TestDaysBetweenAcrossDST(t *testing.T) {
+	paris, err := time.LoadLocation("Europe/Paris")
+	if err != nil {
+		t.Skip("no time zone database", err)
+	}
+	before := time.Date(2018, 3, 24, 0, 0, 0, 0, paris)
+	after := time.Date(2018, 3, 26, 0, 0, 0, 0, paris)
+	if days := daysBetween(before, after); days != 2 {
+		t.Errorf("Expected 2 days across the change to summer time, got %d", days)
+	}
+}
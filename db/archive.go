@@ -0,0 +1,115 @@
+package db
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+// ArchivePath returns the path of the archive of a database file
+func ArchivePath(target string) string {
+	return target + ".archive"
+}
+
+// ArchiveOf returns the store keeping the todos archived from a store: a JSON
+// file next to the database file, or another memory store. It is guarded by
+// the lock of the store.
+func ArchiveOf(store Store) (Store, error) {
+	switch s := store.(type) {
+	case *FileStore:
+		return NewFileStore(ArchivePath(s.Path)), nil
+	case *SQLiteStore:
+		return NewFileStore(ArchivePath(s.Path)), nil
+	case *MemStore:
+		return NewMemStore(ArchivePath(s.Name)), nil
+	default:
+		return nil, fmt.Errorf("This storage has no archive")
+	}
+}
+
+// LoadArchive returns the todos archived from a store, from the oldest
+func LoadArchive(store Store) ([]json.RawMessage, error) {
+	archive, err := ArchiveOf(store)
+	if err != nil {
+		return nil, err
+	}
+	if archive.Check() != nil {
+		return []json.RawMessage{}, nil
+	}
+	return archive.Load()
+}
+
+// Archive appends todos to the archive of a store. A todo already archived,
+// because the list couldn't be written after its archiving, is replaced
+// rather than archived twice.
+func Archive(store Store, todos []json.RawMessage) error {
+	if len(todos) == 0 {
+		return nil
+	}
+	archive, err := ArchiveOf(store)
+	if err != nil {
+		return err
+	}
+	if archive.Check() != nil {
+		if err := archive.Initialize(); err != nil {
+			return err
+		}
+	}
+	archived, err := archive.Load()
+	if err != nil {
+		return err
+	}
+
+	indexes := map[string]int{}
+	for i, todo := range archived {
+		if uid := uidOf(todo); uid != "" {
+			indexes[uid] = i
+		}
+	}
+	for _, todo := range todos {
+		if i, ok := indexes[uidOf(todo)]; ok {
+			archived[i] = todo
+			continue
+		}
+		archived = append(archived, todo)
+	}
+	return archive.Save(archived)
+}
+
+// Unarchive removes todos from the archive of a store, designated by their uid
+func Unarchive(store Store, todos []json.RawMessage) error {
+	if len(todos) == 0 {
+		return nil
+	}
+	removed := map[string]bool{}
+	for _, todo := range todos {
+		removed[uidOf(todo)] = true
+	}
+
+	archive, err := ArchiveOf(store)
+	if err != nil {
+		return err
+	}
+	archived, err := LoadArchive(store)
+	if err != nil {
+		return err
+	}
+	kept := []json.RawMessage{}
+	for _, todo := range archived {
+		if !removed[uidOf(todo)] {
+			kept = append(kept, todo)
+		}
+	}
+	if len(kept) == len(archived) {
+		return nil
+	}
+	return archive.Save(kept)
+}
+
+// uidOf returns the uid of a todo
+func uidOf(todo json.RawMessage) string {
+	var fields struct {
+		UID string `json:"uid"`
+	}
+	json.Unmarshal(todo, &fields)
+	return fields.UID
+}
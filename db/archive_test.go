@@ -0,0 +1,45 @@
+package db
+
+import (
+	"encoding/json"
+	"path/filepath"
+	"testing"
+)
+
+func TestArchive(t *testing.T) {
+	store := NewFileStore(filepath.Join(t.TempDir(), FileName))
+	store.Initialize()
+
+	archived, err := LoadArchive(store)
+	if err != nil || len(archived) != 0 {
+		t.Fatalf("Expected an empty archive before the first clean, got %d todos (%v)", len(archived), err)
+	}
+
+	first := json.RawMessage(`{"id":1,"desc":"first","uid":"aaaa1111"}`)
+	second := json.RawMessage(`{"id":2,"desc":"second","uid":"bbbb2222"}`)
+	if err := Archive(store, []json.RawMessage{first}); err != nil {
+		t.Fatal(err)
+	}
+	if err := Archive(store, []json.RawMessage{second}); err != nil {
+		t.Fatal(err)
+	}
+	if err := sameTodos(NewFileStore(ArchivePath(store.Path)), []json.RawMessage{first, second}); err != nil {
+		t.Fatalf("Expected the todos appended to the archive file: %s", err)
+	}
+
+	// a clean whose list was not written archives the same todos again
+	again := json.RawMessage(`{"id":1,"desc":"first again","uid":"aaaa1111"}`)
+	if err := Archive(store, []json.RawMessage{again}); err != nil {
+		t.Fatal(err)
+	}
+	if err := sameTodos(NewFileStore(ArchivePath(store.Path)), []json.RawMessage{again, second}); err != nil {
+		t.Fatalf("Expected a todo archived twice to be replaced: %s", err)
+	}
+
+	if err := Unarchive(store, []json.RawMessage{first}); err != nil {
+		t.Fatal(err)
+	}
+	if archived, _ = LoadArchive(store); len(archived) != 1 || uidOf(archived[0]) != "bbbb2222" {
+		t.Errorf("Expected only the second todo left in the archive, got %d todos", len(archived))
+	}
+}
@@ -4,19 +4,52 @@ import (
 	"fmt"
 	"os"
 	"path"
-
-	"github.com/deild/td/helper"
+	"path/filepath"
+	"strings"
 )
 
 // EnvDBPath environnement variable name for todo DB file
 const EnvDBPath = "TODO_DB_PATH"
 
+// EnvDBCeiling environnement variable name for the list of directories
+// where the lookup of a todo DB file stops, like GIT_CEILING_DIRECTORIES
+const EnvDBCeiling = "TODO_DB_CEILING"
+
+// FileName name of the todo DB file looked up in each directory
+const FileName = ".todos"
+
+// Source tells how the path of the database file was resolved
+type Source int
+
+const (
+	// SourceEnv the path comes from the TODO_DB_PATH environnement variable
+	SourceEnv Source = iota
+	// SourceLookup a .todos file was found in the current directory or one of its parents
+	SourceLookup
+	// SourceDefault no .todos file was found, the path defaults to the current directory
+	SourceDefault
+)
+
 // DataStore structure
 type DataStore struct {
 	Path string
+	// Source and Reason explain why Path was picked
+	Source Source
+	Reason string
 }
 
-// NewDataStore search the path of database file
+// NewDataStore search the path of database file.
+//
+// TODO_DB_PATH is either a file path or an URL selecting the storage:
+// file:///home/me/.todos, sqlite:///home/me/.todos or mem://name (see OpenStore).
+//
+// The resolution order is:
+//  1. the TODO_DB_PATH environnement variable, when it is set;
+//  2. the nearest .todos file in the current directory or one of its
+//     parents. The lookup stops at the filesystem root, before entering a
+//     directory listed in TODO_DB_CEILING, or after a directory holding a
+//     .git entry (the root of a repository);
+//  3. a .todos file in the current directory.
 func NewDataStore() (*DataStore, error) {
 	ds := new(DataStore)
 	ds.Path = os.Getenv(EnvDBPath)
@@ -26,19 +59,39 @@ func NewDataStore() (*DataStore, error) {
 		if err != nil {
 			return ds, err
 		}
-		ds.Path = path.Join(cwd, ".todos")
+
+		found, reason := lookup(cwd, ceilings())
+		if found != "" {
+			ds.Path = found
+			ds.Source = SourceLookup
+			ds.Reason = reason
+			return ds, nil
+		}
+
+		ds.Path = path.Join(cwd, FileName)
+		ds.Source = SourceDefault
+		ds.Reason = fmt.Sprintf("no %s file found from \"%s\" upward (%s), defaulting to the current directory", FileName, cwd, reason)
 
 	} else {
+		ds.Source = SourceEnv
+		ds.Reason = fmt.Sprintf("%s is set", EnvDBPath)
+
+		if strings.HasPrefix(ds.Path, "file://") {
+			ds.Path = strings.TrimPrefix(ds.Path, "file://")
+		} else if strings.Contains(ds.Path, "://") {
+			return ds, nil
+		}
+
 		dir, file := path.Split(ds.Path)
 		if file == "" {
-			ds.Path = path.Join(dir, ".todos")
+			ds.Path = path.Join(dir, FileName)
 		}
 
 		fileInfo, err := os.Stat(ds.Path)
 
 		if os.IsExist(err) {
 			if fileInfo.IsDir() {
-				ds.Path = path.Join(ds.Path, ".todos")
+				ds.Path = path.Join(ds.Path, FileName)
 				err = os.Setenv(EnvDBPath, ds.Path)
 				if err != nil {
 					return ds, err
@@ -50,38 +103,87 @@ func NewDataStore() (*DataStore, error) {
 	return ds, nil
 }
 
-// Check if the database file exist
-func (d *DataStore) Check() error {
-	_, err := os.Stat(d.Path)
-	if os.IsNotExist(err) {
-		return fmt.Errorf("The database file \"%s\" doesn't exists", d.Path)
+// NewLocalDataStore returns the database file of the current directory,
+// without looking into the parents. TODO_DB_PATH still takes precedence.
+func NewLocalDataStore() (*DataStore, error) {
+	if os.Getenv(EnvDBPath) != "" {
+		return NewDataStore()
 	}
-	return nil
-}
 
-// Initialize the database file
-func (d *DataStore) Initialize() error {
-	var err error
-	dir, _ := path.Split(d.Path)
-	_, err = os.Stat(dir)
-	if os.IsNotExist(err) {
-		return fmt.Errorf("%s: One or more directories in this path doesn't exist", dir)
+	cwd, err := os.Getwd()
+	if err != nil {
+		return nil, err
 	}
+	return &DataStore{
+		Path:   path.Join(cwd, FileName),
+		Source: SourceDefault,
+		Reason: "the current directory",
+	}, nil
+}
 
-	_, err = os.Stat(d.Path)
-	if os.IsNotExist(err) {
-		var w *os.File
-		w, err = os.Create(d.Path)
-		if err != nil {
-			return err
+// lookup walks from dir up to the filesystem root and returns the first
+// .todos file found. When nothing is found, the reason tells where the walk stopped.
+func lookup(dir string, ceilings []string) (found string, reason string) {
+	start := dir
+	for {
+		candidate := filepath.Join(dir, FileName)
+		if fileInfo, err := os.Stat(candidate); err == nil && !fileInfo.IsDir() {
+			if dir == start {
+				return candidate, fmt.Sprintf("%s file found in the current directory", FileName)
+			}
+			return candidate, fmt.Sprintf("nearest %s file found in parent directory \"%s\"", FileName, dir)
 		}
-		defer helper.Check(w.Close)
-		_, err = w.WriteString("[]")
-		if err != nil {
-			return err
+
+		if _, err := os.Stat(filepath.Join(dir, ".git")); err == nil {
+			return "", fmt.Sprintf("stopped at repository root \"%s\"", dir)
+		}
+
+		// a ceiling directory is searched, but not its parents
+		for _, ceiling := range ceilings {
+			if dir == ceiling {
+				return "", fmt.Sprintf("stopped at ceiling directory \"%s\" from %s", dir, EnvDBCeiling)
+			}
+		}
+
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return "", "reached the filesystem root"
 		}
-		return w.Sync()
+		dir = parent
 	}
-	return fmt.Errorf("%s: To-do file has been initialized before", d.Path)
+}
+
+// ceilings returns the cleaned directories listed in TODO_DB_CEILING
+func ceilings() []string {
+	var dirs []string
+	for _, dir := range filepath.SplitList(os.Getenv(EnvDBCeiling)) {
+		if dir = strings.TrimSpace(dir); dir == "" || !filepath.IsAbs(dir) {
+			continue
+		}
+		dirs = append(dirs, filepath.Clean(dir))
+	}
+	return dirs
+}
 
+// Store opens the store located at Path
+func (d *DataStore) Store() (Store, error) {
+	return OpenStore(d.Path)
+}
+
+// Check if the database file exist
+func (d *DataStore) Check() error {
+	store, err := d.Store()
+	if err != nil {
+		return err
+	}
+	return store.Check()
+}
+
+// Initialize the database file
+func (d *DataStore) Initialize() error {
+	store, err := d.Store()
+	if err != nil {
+		return err
+	}
+	return store.Initialize()
 }
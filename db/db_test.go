@@ -2,8 +2,10 @@ package db
 
 import (
 	"fmt"
+	"io/ioutil"
 	"os"
 	"path"
+	"path/filepath"
 	"testing"
 	"time"
 )
@@ -31,3 +33,110 @@ func TestWhenDirExist(t *testing.T) {
 	os.RemoveAll(path.Join(cwd, "/TODOtestingFOLDER/"))
 	os.Unsetenv(EnvDBPath)
 }
+
+func lookupTree(t *testing.T) (root string, deep string) {
+	root, err := filepath.EvalSymlinks(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	deep = filepath.Join(root, "repo", "a", "b")
+	if err := os.MkdirAll(deep, 0700); err != nil {
+		t.Fatal(err)
+	}
+	os.Setenv(EnvDBCeiling, filepath.Dir(root))
+	return root, deep
+}
+
+func chdir(t *testing.T, dir string) func() {
+	cwd, _ := os.Getwd()
+	if err := os.Chdir(dir); err != nil {
+		t.Fatal(err)
+	}
+	return func() {
+		os.Chdir(cwd)
+		os.Unsetenv(EnvDBCeiling)
+	}
+}
+
+func TestLookupParent(t *testing.T) {
+	root, deep := lookupTree(t)
+	expected := filepath.Join(root, "repo", FileName)
+	ioutil.WriteFile(expected, []byte("[]"), 0600)
+	defer chdir(t, deep)()
+
+	ds, err := NewDataStore()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ds.Path != expected {
+		t.Errorf("Expected \"%s\", got \"%s\"", expected, ds.Path)
+	}
+	if ds.Source != SourceLookup {
+		t.Errorf("Expected the path to come from the lookup, got %d", ds.Source)
+	}
+}
+
+func TestLookupNearest(t *testing.T) {
+	root, deep := lookupTree(t)
+	ioutil.WriteFile(filepath.Join(root, "repo", FileName), []byte("[]"), 0600)
+	expected := filepath.Join(root, "repo", "a", FileName)
+	ioutil.WriteFile(expected, []byte("[]"), 0600)
+	defer chdir(t, deep)()
+
+	ds, _ := NewDataStore()
+	if ds.Path != expected {
+		t.Errorf("Expected \"%s\", got \"%s\"", expected, ds.Path)
+	}
+}
+
+func TestLookupStopsAtRepository(t *testing.T) {
+	root, deep := lookupTree(t)
+	ioutil.WriteFile(filepath.Join(root, FileName), []byte("[]"), 0600)
+	os.Mkdir(filepath.Join(root, "repo", ".git"), 0700)
+	defer chdir(t, deep)()
+
+	ds, _ := NewDataStore()
+	expected := filepath.Join(deep, FileName)
+	if ds.Path != expected {
+		t.Errorf("Expected \"%s\", got \"%s\"", expected, ds.Path)
+	}
+	if ds.Source != SourceDefault {
+		t.Errorf("Expected the path to be the default one, got %d", ds.Source)
+	}
+}
+
+func TestLookupStopsAtCeiling(t *testing.T) {
+	root, deep := lookupTree(t)
+	ioutil.WriteFile(filepath.Join(root, FileName), []byte("[]"), 0600)
+	defer chdir(t, deep)()
+	ceiling := filepath.Join(root, "repo")
+	os.Setenv(EnvDBCeiling, ceiling)
+
+	ds, _ := NewDataStore()
+	expected := filepath.Join(deep, FileName)
+	if ds.Path != expected {
+		t.Errorf("Expected \"%s\", got \"%s\"", expected, ds.Path)
+	}
+
+	// the ceiling directory itself is searched
+	ioutil.WriteFile(filepath.Join(ceiling, FileName), []byte("[]"), 0600)
+	ds, _ = NewDataStore()
+	expected = filepath.Join(ceiling, FileName)
+	if ds.Path != expected {
+		t.Errorf("Expected \"%s\", got \"%s\"", expected, ds.Path)
+	}
+}
+
+func TestEnvTakesPrecedence(t *testing.T) {
+	root, deep := lookupTree(t)
+	ioutil.WriteFile(filepath.Join(root, FileName), []byte("[]"), 0600)
+	defer chdir(t, deep)()
+	expected := filepath.Join(root, "elsewhere.json")
+	os.Setenv(EnvDBPath, expected)
+	defer os.Unsetenv(EnvDBPath)
+
+	ds, _ := NewDataStore()
+	if ds.Path != expected || ds.Source != SourceEnv {
+		t.Errorf("Expected \"%s\" from %s, got \"%s\"", expected, EnvDBPath, ds.Path)
+	}
+}
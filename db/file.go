@@ -0,0 +1,274 @@
+package db
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+
+	"github.com/deild/td/helper"
+)
+
+// EnvBackups environnement variable name for the number of backups of the
+// todo DB file kept on each write
+const EnvBackups = "TODO_DB_BACKUPS"
+
+// FileStore keeps the todos in a JSON file
+type FileStore struct {
+	Path string
+	// lock is the lock file held between Lock and Unlock
+	lock *os.File
+}
+
+// NewFileStore returns the store of the JSON file at path
+func NewFileStore(path string) *FileStore {
+	return &FileStore{Path: path}
+}
+
+// Check if the database file exist
+func (f *FileStore) Check() error {
+	_, err := os.Stat(f.Path)
+	if os.IsNotExist(err) {
+		return fmt.Errorf("The database file \"%s\" doesn't exists", f.Path)
+	}
+	return nil
+}
+
+// Initialize the database file
+func (f *FileStore) Initialize() error {
+	var err error
+	dir, _ := path.Split(f.Path)
+	_, err = os.Stat(dir)
+	if os.IsNotExist(err) {
+		return fmt.Errorf("%s: One or more directories in this path doesn't exist", dir)
+	}
+
+	_, err = os.Stat(f.Path)
+	if os.IsNotExist(err) {
+		var w *os.File
+		w, err = os.Create(f.Path)
+		if err != nil {
+			return err
+		}
+		defer helper.Check(w.Close)
+		content, err := encode(nil)
+		if err != nil {
+			return err
+		}
+		if _, err = w.Write(content); err != nil {
+			return err
+		}
+		return w.Sync()
+	}
+	return fmt.Errorf("%s: To-do file has been initialized before", f.Path)
+
+}
+
+// Load read the todos from the database file, upgraded to the current
+// version of the format
+func (f *FileStore) Load() ([]json.RawMessage, error) {
+	content, err := ioutil.ReadFile(f.Path)
+	if err != nil {
+		return nil, err
+	}
+	todos, err := decode(content)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %s", f.Path, err)
+	}
+	return todos, nil
+}
+
+// Save write the todos in the database file, in the current version of the
+// format. A file written by a newer version of td is never overwritten.
+func (f *FileStore) Save(todos []json.RawMessage) error {
+	if content, err := ioutil.ReadFile(f.Path); err == nil && len(bytes.TrimSpace(content)) > 0 {
+		if _, version, err := decodeVersion(content); err == nil {
+			if err := checkVersion(version); err != nil {
+				return fmt.Errorf("%s: %s", f.Path, err)
+			}
+		}
+	}
+
+	data, err := encode(todos)
+	if err != nil {
+		return err
+	}
+	return f.Write(func(w io.Writer) error {
+		_, err := w.Write(data)
+		return err
+	})
+}
+
+// Write replaces the content of the database file with what write produces.
+//
+// The content goes to a temporary file in the same directory, which is
+// synced and then renamed over the database file: a crash or an error in
+// write never leaves a truncated file behind. The file mode is preserved.
+// When TODO_DB_BACKUPS is set to N, the previous contents are kept as
+// .todos.bak.1 (the newest) to .todos.bak.N.
+func (f *FileStore) Write(write func(w io.Writer) error) error {
+	target, err := filepath.EvalSymlinks(f.Path)
+	if err != nil {
+		return err
+	}
+	return writeFile(target, true, write)
+}
+
+// sideFile reads a file kept next to the todos of a store, like the journal,
+// and returns how to write it. A file store and a SQLite store keep it next
+// to their database file, at the path returned by name; a memory store keeps
+// it in memory. ok is false for the other stores. A missing file is empty.
+func sideFile(store Store, name func(target string) string) (content []byte, write func(content []byte) error, ok bool, err error) {
+	switch s := store.(type) {
+	case *FileStore:
+		content, write, err = localFile(name(s.Path))
+	case *SQLiteStore:
+		content, write, err = localFile(name(s.Path))
+	case *MemStore:
+		key := name(s.Name)
+		memStores.Lock()
+		content = memStores.files[key]
+		memStores.Unlock()
+		write = func(content []byte) error {
+			memStores.Lock()
+			defer memStores.Unlock()
+			memStores.files[key] = content
+			return nil
+		}
+	default:
+		return nil, nil, false, nil
+	}
+	return content, write, true, err
+}
+
+// localFile reads the file at path, and returns how to write it
+func localFile(path string) ([]byte, func(content []byte) error, error) {
+	content, err := ioutil.ReadFile(path)
+	if err != nil && !os.IsNotExist(err) {
+		return nil, nil, err
+	}
+	return content, func(content []byte) error {
+		return writeFile(path, false, func(w io.Writer) error {
+			_, err := w.Write(content)
+			return err
+		})
+	}, nil
+}
+
+// writeFile replaces the content of target atomically, see FileStore.Write.
+// The backups are only rotated when backup is set.
+func writeFile(target string, backup bool, write func(w io.Writer) error) (err error) {
+	mode := os.FileMode(0600)
+	if fileInfo, err := os.Stat(target); err == nil {
+		mode = fileInfo.Mode().Perm()
+	}
+
+	tmp, err := ioutil.TempFile(filepath.Dir(target), filepath.Base(target)+".tmp")
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err != nil {
+			tmp.Close()
+			os.Remove(tmp.Name())
+		}
+	}()
+
+	if err = write(tmp); err != nil {
+		return err
+	}
+	if err = tmp.Chmod(mode); err != nil {
+		return err
+	}
+	if err = tmp.Sync(); err != nil {
+		return err
+	}
+	if err = tmp.Close(); err != nil {
+		return err
+	}
+
+	if backup {
+		if err = rotateBackups(target); err != nil {
+			return err
+		}
+	}
+	if err = os.Rename(tmp.Name(), target); err != nil {
+		return err
+	}
+	syncDir(filepath.Dir(target))
+	return nil
+}
+
+// BackupPath returns the path of the nth backup of the database file
+func (f *FileStore) BackupPath(n int) string {
+	return backupPath(f.Path, n)
+}
+
+func backupPath(target string, n int) string {
+	return target + ".bak." + strconv.Itoa(n)
+}
+
+// rotateBackups shifts the existing backups and copies target as the newest one
+func rotateBackups(target string) error {
+	value := os.Getenv(EnvBackups)
+	if value == "" {
+		return nil
+	}
+	count, err := strconv.Atoi(value)
+	if err != nil || count < 0 {
+		return fmt.Errorf("%s: \"%s\" is not a number of backups", EnvBackups, value)
+	}
+	if count == 0 {
+		return nil
+	}
+
+	if err := os.Remove(backupPath(target, count)); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	for n := count - 1; n >= 1; n-- {
+		err := os.Rename(backupPath(target, n), backupPath(target, n+1))
+		if err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+	return copyFile(target, backupPath(target, 1))
+}
+
+func copyFile(src, dst string) error {
+	in, err := os.Open(src)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	out, err := os.OpenFile(dst, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0600)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		return err
+	}
+	if err := out.Sync(); err != nil {
+		out.Close()
+		return err
+	}
+	return out.Close()
+}
+
+// syncDir makes the rename durable. It is best effort: some systems can't
+// open or sync a directory.
+func syncDir(dir string) {
+	if d, err := os.Open(dir); err == nil {
+		d.Sync()
+		d.Close()
+	}
+}
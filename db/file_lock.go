@@ -0,0 +1,100 @@
+package db
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// EnvLockTimeout environnement variable name for the time to wait for a locked todo DB file
+const EnvLockTimeout = "TODO_LOCK_TIMEOUT"
+
+// DefaultLockTimeout time to wait for a locked todo DB file when TODO_LOCK_TIMEOUT is not set
+const DefaultLockTimeout = 5 * time.Second
+
+// lockRetry delay between two attempts to take the lock
+const lockRetry = 20 * time.Millisecond
+
+// LockPath returns the path of the lock file guarding the database file
+func (f *FileStore) LockPath() string {
+	return lockPath(f.Path)
+}
+
+// Lock takes an exclusive advisory lock on the database file, shared by every
+// td process. It waits up to TODO_LOCK_TIMEOUT before giving up.
+func (f *FileStore) Lock() (err error) {
+	if f.lock == nil {
+		f.lock, err = lockFile(f.Path)
+	}
+	return err
+}
+
+// Unlock releases the lock taken by Lock
+func (f *FileStore) Unlock() error {
+	if f.lock == nil {
+		return nil
+	}
+	file := f.lock
+	f.lock = nil
+	return release(file)
+}
+
+func lockPath(target string) string {
+	return target + ".lock"
+}
+
+// lockFile waits for the lock file of target and returns it once held
+func lockFile(target string) (*os.File, error) {
+	timeout, err := lockTimeout()
+	if err != nil {
+		return nil, err
+	}
+
+	deadline := time.Now().Add(timeout)
+	for {
+		file, err := acquire(lockPath(target))
+		if err != nil {
+			return nil, err
+		}
+		if file != nil {
+			return file, writePid(file)
+		}
+		if time.Now().After(deadline) {
+			return nil, lockedError(target)
+		}
+		time.Sleep(lockRetry)
+	}
+}
+
+func lockedError(target string) error {
+	pid, err := ioutil.ReadFile(lockPath(target))
+	if err != nil || strings.TrimSpace(string(pid)) == "" {
+		return fmt.Errorf("The list \"%s\" is locked by another process", target)
+	}
+	return fmt.Errorf("The list \"%s\" is locked by pid %s", target, strings.TrimSpace(string(pid)))
+}
+
+func writePid(file *os.File) error {
+	if err := file.Truncate(0); err != nil {
+		return err
+	}
+	if _, err := file.WriteAt([]byte(strconv.Itoa(os.Getpid())), 0); err != nil {
+		return err
+	}
+	return file.Sync()
+}
+
+func lockTimeout() (time.Duration, error) {
+	value := os.Getenv(EnvLockTimeout)
+	if value == "" {
+		return DefaultLockTimeout, nil
+	}
+	timeout, err := time.ParseDuration(value)
+	if err != nil {
+		return 0, fmt.Errorf("%s: %s", EnvLockTimeout, err)
+	}
+	return timeout, nil
+}
@@ -0,0 +1,41 @@
+//go:build linux || darwin || freebsd || netbsd || openbsd || dragonfly
+// +build linux darwin freebsd netbsd openbsd dragonfly
+
+package db
+
+import (
+	"os"
+	"syscall"
+)
+
+// acquire takes a flock on the lock file, or returns a nil file when another
+// process holds it. The lock is released by the kernel if the process dies.
+func acquire(path string) (*os.File, error) {
+	file, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0600)
+	if err != nil {
+		return nil, err
+	}
+	err = syscall.Flock(int(file.Fd()), syscall.LOCK_EX|syscall.LOCK_NB)
+	if err == syscall.EWOULDBLOCK {
+		return nil, file.Close()
+	}
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+	return file, nil
+}
+
+// release unlocks the lock file. The file is kept on disk so that every
+// process always locks the same inode.
+func release(file *os.File) error {
+	if err := file.Truncate(0); err != nil {
+		file.Close()
+		return err
+	}
+	if err := syscall.Flock(int(file.Fd()), syscall.LOCK_UN); err != nil {
+		file.Close()
+		return err
+	}
+	return file.Close()
+}
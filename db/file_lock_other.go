@@ -0,0 +1,27 @@
+//go:build !linux && !darwin && !freebsd && !netbsd && !openbsd && !dragonfly
+// +build !linux,!darwin,!freebsd,!netbsd,!openbsd,!dragonfly
+
+package db
+
+import (
+	"os"
+)
+
+// acquire creates the lock file exclusively, or returns a nil file when it
+// already exists. A process that dies while holding the lock leaves the file
+// behind: it has to be removed by hand.
+func acquire(path string) (*os.File, error) {
+	file, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE|os.O_EXCL, 0600)
+	if os.IsExist(err) {
+		return nil, nil
+	}
+	return file, err
+}
+
+// release removes the lock file
+func release(file *os.File) error {
+	if err := file.Close(); err != nil {
+		return err
+	}
+	return os.Remove(file.Name())
+}
@@ -0,0 +1,82 @@
+package db
+
+import (
+	"errors"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func writeString(content string) func(w io.Writer) error {
+	return func(w io.Writer) error {
+		_, err := io.WriteString(w, content)
+		return err
+	}
+}
+
+func TestWriteReplacesContent(t *testing.T) {
+	ds := NewFileStore(filepath.Join(t.TempDir(), FileName))
+	ioutil.WriteFile(ds.Path, []byte("[]"), 0640)
+
+	if err := ds.Write(writeString(`[{"id":1}]`)); err != nil {
+		t.Fatal(err)
+	}
+
+	content, _ := ioutil.ReadFile(ds.Path)
+	if string(content) != `[{"id":1}]` {
+		t.Errorf("Expected the new content, got \"%s\"", content)
+	}
+	fileInfo, _ := os.Stat(ds.Path)
+	if fileInfo.Mode().Perm() != 0640 {
+		t.Errorf("Expected the file mode to be preserved, got %v", fileInfo.Mode())
+	}
+}
+
+func TestFailingWriteKeepsOriginal(t *testing.T) {
+	dir := t.TempDir()
+	ds := NewFileStore(filepath.Join(dir, FileName))
+	ioutil.WriteFile(ds.Path, []byte(`[{"id":1}]`), 0600)
+
+	err := ds.Write(func(w io.Writer) error {
+		io.WriteString(w, `[{"id":`)
+		return errors.New("disk full")
+	})
+	if err == nil {
+		t.Fatal("Expected the write to fail")
+	}
+
+	content, _ := ioutil.ReadFile(ds.Path)
+	if string(content) != `[{"id":1}]` {
+		t.Errorf("Expected the original content to survive, got \"%s\"", content)
+	}
+	files, _ := ioutil.ReadDir(dir)
+	if len(files) != 1 {
+		t.Errorf("Expected the temporary file to be removed, got %d files", len(files))
+	}
+}
+
+func TestWriteRotatesBackups(t *testing.T) {
+	ds := NewFileStore(filepath.Join(t.TempDir(), FileName))
+	ioutil.WriteFile(ds.Path, []byte("0"), 0600)
+	os.Setenv(EnvBackups, "2")
+	defer os.Unsetenv(EnvBackups)
+
+	for _, content := range []string{"1", "2", "3"} {
+		if err := ds.Write(writeString(content)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	expected := map[string]string{ds.Path: "3", ds.BackupPath(1): "2", ds.BackupPath(2): "1"}
+	for file, want := range expected {
+		content, _ := ioutil.ReadFile(file)
+		if string(content) != want {
+			t.Errorf("Expected \"%s\" in %s, got \"%s\"", want, file, content)
+		}
+	}
+	if _, err := os.Stat(ds.BackupPath(3)); !os.IsNotExist(err) {
+		t.Error("Expected only 2 backups to be kept")
+	}
+}
@@ -0,0 +1,350 @@
+package db
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"time"
+)
+
+// EnvJournalDepth environnement variable name for the number of commands
+// kept in the journal, 0 to disable it
+const EnvJournalDepth = "TODO_JOURNAL_DEPTH"
+
+// DefaultJournalDepth number of commands kept in the journal when
+// TODO_JOURNAL_DEPTH is not set
+const DefaultJournalDepth = 20
+
+// Entry of the journal: the todos before and after a command changed them.
+// Only the todos changed are kept, by their uid, see Record.
+type Entry struct {
+	Command string    `json:"command"`
+	Date    time.Time `json:"date"`
+	// Changes are the todos changed, added or removed by the command
+	Changes []Change `json:"changes,omitempty"`
+	// BeforeOrder and AfterOrder are the uids of the todos in their order,
+	// when the command added, removed or moved todos
+	BeforeOrder []string `json:"before_order,omitempty"`
+	AfterOrder  []string `json:"after_order,omitempty"`
+	// BeforeSum and AfterSum identify all the todos before and after the
+	// command, to check they have not been changed since
+	BeforeSum string `json:"before_sum,omitempty"`
+	AfterSum  string `json:"after_sum,omitempty"`
+	// Before and After are all the todos, kept as they are when some of them
+	// have no uid
+	Before []json.RawMessage `json:"before,omitempty"`
+	After  []json.RawMessage `json:"after,omitempty"`
+	// Archived are the todos the command moved to the archive, and Restored
+	// the ones it took back from it
+	Archived []json.RawMessage `json:"archived,omitempty"`
+	Restored []json.RawMessage `json:"restored,omitempty"`
+}
+
+// Change of a todo by a command: Before is empty for a todo added, After for
+// a todo removed
+type Change struct {
+	UID    string          `json:"uid"`
+	Before json.RawMessage `json:"before,omitempty"`
+	After  json.RawMessage `json:"after,omitempty"`
+}
+
+// Journal keeps the last commands which changed the todos of a store, to
+// undo and redo them. It must only be used while the store is locked.
+type Journal struct {
+	// Version of the format of the todos in the entries
+	Version int `json:"version"`
+	// Entries from the oldest to the newest
+	Entries []Entry `json:"entries"`
+	// Undone is the number of the newest entries which have been undone,
+	// and can be redone
+	Undone int `json:"undone"`
+	// write saves the encoded journal
+	write func(content []byte) error
+}
+
+// JournalPath returns the path of the journal of a database file
+func JournalPath(target string) string {
+	return target + ".journal"
+}
+
+// OpenJournal returns the journal of a store, see sideFile. The entries written by
+// another version of the format are dropped, they can't be restored.
+func OpenJournal(store Store) (*Journal, error) {
+	content, write, ok, err := sideFile(store, JournalPath)
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		return nil, errors.New("This storage has no journal")
+	}
+
+	journal := &Journal{Version: Version, write: write}
+	if len(content) > 0 {
+		var saved Journal
+		if err := json.Unmarshal(content, &saved); err != nil {
+			return nil, fmt.Errorf("The journal is not valid: %s", err)
+		}
+		if saved.Version == Version {
+			journal.Entries = saved.Entries
+			journal.Undone = saved.Undone
+		}
+	}
+	return journal, nil
+}
+
+// Record adds a command to the journal. The entries undone are dropped, and
+// only the last TODO_JOURNAL_DEPTH entries are kept. A command which didn't
+// change the todos is not recorded.
+func (j *Journal) Record(entry Entry) error {
+	depth, err := journalDepth()
+	if err != nil || depth == 0 {
+		return err
+	}
+	if sameRecords(entry.Before, entry.After) {
+		return nil
+	}
+	entry = entry.changes()
+
+	j.Entries = append(j.Entries[:len(j.Entries)-j.Undone], entry)
+	j.Undone = 0
+	if len(j.Entries) > depth {
+		j.Entries = j.Entries[len(j.Entries)-depth:]
+	}
+	return j.save()
+}
+
+// Undo restores the todos of the store as they were before the last command,
+// which is returned. It is refused when the todos have been changed since
+// the command, outside of td.
+func (j *Journal) Undo(store Store) (Entry, error) {
+	if len(j.Entries) == j.Undone {
+		return Entry{}, errors.New("There's nothing to undo.")
+	}
+	entry := j.Entries[len(j.Entries)-j.Undone-1]
+
+	if err := j.restore(store, entry, true); err == errChanged {
+		return entry, fmt.Errorf("The todos have been changed since \"%s\", it can't be undone.", entry.Command)
+	} else if err != nil {
+		return entry, err
+	}
+	if err := Unarchive(store, entry.Archived); err != nil {
+		return entry, err
+	}
+	if err := Archive(store, entry.Restored); err != nil {
+		return entry, err
+	}
+	j.Undone++
+	return entry, j.save()
+}
+
+// Redo applies again the last command undone, which is returned. It is
+// refused when the todos have been changed since it was undone.
+func (j *Journal) Redo(store Store) (Entry, error) {
+	if j.Undone == 0 {
+		return Entry{}, errors.New("There's nothing to redo.")
+	}
+	entry := j.Entries[len(j.Entries)-j.Undone]
+
+	if err := j.restore(store, entry, false); err == errChanged {
+		return entry, fmt.Errorf("The todos have been changed since \"%s\" was undone, it can't be redone.", entry.Command)
+	} else if err != nil {
+		return entry, err
+	}
+	if err := Unarchive(store, entry.Restored); err != nil {
+		return entry, err
+	}
+	if err := Archive(store, entry.Archived); err != nil {
+		return entry, err
+	}
+	j.Undone--
+	return entry, j.save()
+}
+
+// errChanged tells that the todos of the store don't match the journal
+var errChanged = errors.New("The todos don't match the journal")
+
+// restore puts back the todos of the store as they were before the command
+// of an entry when undo is set, or after it, when they still are as they were
+// after it, or before it
+func (j *Journal) restore(store Store, entry Entry, undo bool) error {
+	current, err := store.Load()
+	if err != nil {
+		return err
+	}
+
+	from, to := entry.Before, entry.After
+	if undo {
+		from, to = to, from
+	}
+	if entry.AfterSum == "" {
+		if !sameRecords(current, from) {
+			return errChanged
+		}
+		return store.Save(to)
+	}
+
+	fromSum, toSum, order := entry.BeforeSum, entry.AfterSum, entry.AfterOrder
+	if undo {
+		fromSum, toSum, order = toSum, fromSum, entry.BeforeOrder
+	}
+	if sum, _ := checksum(current); sum != fromSum {
+		return errChanged
+	}
+
+	byUID := map[string]json.RawMessage{}
+	var currentOrder []string
+	for _, todo := range current {
+		byUID[uidOf(todo)] = todo
+		currentOrder = append(currentOrder, uidOf(todo))
+	}
+	for _, change := range entry.Changes {
+		record := change.After
+		if undo {
+			record = change.Before
+		}
+		if len(record) == 0 {
+			delete(byUID, change.UID)
+		} else {
+			byUID[change.UID] = record
+		}
+	}
+	if order == nil {
+		order = currentOrder
+	}
+	todos := make([]json.RawMessage, 0, len(order))
+	for _, uid := range order {
+		todos = append(todos, byUID[uid])
+	}
+	if sum, _ := checksum(todos); sum != toSum {
+		return errChanged
+	}
+	return store.Save(todos)
+}
+
+// changes returns the entry keeping only the todos changed by its command,
+// or the entry as it is when some todos have no uid or share one
+func (e Entry) changes() Entry {
+	beforeSum, before := checksum(e.Before)
+	afterSum, after := checksum(e.After)
+	beforeOrder, ok := uniqueUIDs(e.Before)
+	if !ok {
+		return e
+	}
+	afterOrder, ok := uniqueUIDs(e.After)
+	if !ok {
+		return e
+	}
+
+	var changes []Change
+	afterByUID := map[string]int{}
+	for i, uid := range afterOrder {
+		afterByUID[uid] = i
+	}
+	beforeByUID := map[string]bool{}
+	for i, uid := range beforeOrder {
+		beforeByUID[uid] = true
+		j, ok := afterByUID[uid]
+		switch {
+		case !ok:
+			changes = append(changes, Change{UID: uid, Before: e.Before[i]})
+		case before[i] != after[j]:
+			changes = append(changes, Change{UID: uid, Before: e.Before[i], After: e.After[j]})
+		}
+	}
+	for j, uid := range afterOrder {
+		if !beforeByUID[uid] {
+			changes = append(changes, Change{UID: uid, After: e.After[j]})
+		}
+	}
+
+	compact := Entry{Command: e.Command, Date: e.Date, Changes: changes, BeforeSum: beforeSum, AfterSum: afterSum, Archived: e.Archived, Restored: e.Restored}
+	if !sameUIDs(beforeOrder, afterOrder) {
+		compact.BeforeOrder, compact.AfterOrder = beforeOrder, afterOrder
+	}
+	return compact
+}
+
+// uniqueUIDs returns the uids of todos, unless one has no uid or shares it
+func uniqueUIDs(todos []json.RawMessage) ([]string, bool) {
+	uids := make([]string, len(todos))
+	seen := map[string]bool{}
+	for i, todo := range todos {
+		uids[i] = uidOf(todo)
+		if uids[i] == "" || seen[uids[i]] {
+			return nil, false
+		}
+		seen[uids[i]] = true
+	}
+	return uids, true
+}
+
+func sameUIDs(a []string, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// checksum returns a sum identifying todos whatever their layout, and the
+// compact form of each todo
+func checksum(todos []json.RawMessage) (string, []string) {
+	hash := sha256.New()
+	compacts := make([]string, len(todos))
+	for i, todo := range todos {
+		var compact bytes.Buffer
+		if json.Compact(&compact, todo) != nil {
+			compact.Write(todo)
+		}
+		compacts[i] = compact.String()
+		hash.Write(compact.Bytes())
+		hash.Write([]byte{'\n'})
+	}
+	return hex.EncodeToString(hash.Sum(nil)), compacts
+}
+
+func (j *Journal) save() error {
+	content, err := json.Marshal(j)
+	if err != nil {
+		return err
+	}
+	return j.write(content)
+}
+
+// sameRecords tells if two lists of todos are the same, whatever their layout
+func sameRecords(a []json.RawMessage, b []json.RawMessage) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		var compactA, compactB bytes.Buffer
+		if json.Compact(&compactA, a[i]) != nil || json.Compact(&compactB, b[i]) != nil {
+			return false
+		}
+		if compactA.String() != compactB.String() {
+			return false
+		}
+	}
+	return true
+}
+
+func journalDepth() (int, error) {
+	value := os.Getenv(EnvJournalDepth)
+	if value == "" {
+		return DefaultJournalDepth, nil
+	}
+	depth, err := strconv.Atoi(value)
+	if err != nil || depth < 0 {
+		return 0, fmt.Errorf("%s: \"%s\" is not a number of commands", EnvJournalDepth, value)
+	}
+	return depth, nil
+}
@@ -0,0 +1,222 @@
+package db
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+)
+
+// journalTodos returns the todos after n commands, each adding one todo
+func journalTodos(n int) []json.RawMessage {
+	todos := []json.RawMessage{}
+	for i := 1; i <= n; i++ {
+		todos = append(todos, json.RawMessage(`{"id":`+strconv.Itoa(i)+`,"desc":"todo","status":"pending"}`))
+	}
+	return todos
+}
+
+// recordCommands saves n commands in store and its journal
+func recordCommands(t *testing.T, store Store, n int) *Journal {
+	journal, err := OpenJournal(store)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 1; i <= n; i++ {
+		if err := store.Save(journalTodos(i)); err != nil {
+			t.Fatal(err)
+		}
+		entry := Entry{Command: "td add todo", Date: time.Now(), Before: journalTodos(i - 1), After: journalTodos(i)}
+		if err := journal.Record(entry); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return journal
+}
+
+func TestUndoRedo(t *testing.T) {
+	store := NewMemStore(t.Name())
+	store.Initialize()
+	recordCommands(t, store, 3)
+
+	journal, _ := OpenJournal(store)
+	if len(journal.Entries) != 3 {
+		t.Fatalf("Expected 3 entries, got %d", len(journal.Entries))
+	}
+	for _, expected := range []int{2, 1} {
+		if _, err := journal.Undo(store); err != nil {
+			t.Fatal(err)
+		}
+		if err := sameTodos(store, journalTodos(expected)); err != nil {
+			t.Errorf("Expected %d todos once undone: %s", expected, err)
+		}
+	}
+
+	journal, _ = OpenJournal(store)
+	if journal.Undone != 2 {
+		t.Errorf("Expected 2 entries undone, got %d", journal.Undone)
+	}
+	if _, err := journal.Redo(store); err != nil {
+		t.Fatal(err)
+	}
+	if err := sameTodos(store, journalTodos(2)); err != nil {
+		t.Error(err)
+	}
+
+	// a new command drops the entries left undone
+	store.Save(journalTodos(1))
+	journal.Record(Entry{Command: "td clean", Before: journalTodos(2), After: journalTodos(1)})
+	if len(journal.Entries) != 3 || journal.Undone != 0 {
+		t.Errorf("Expected the undone entry to be dropped, got %d entries and %d undone", len(journal.Entries), journal.Undone)
+	}
+	if _, err := journal.Redo(store); err == nil {
+		t.Error("Expected nothing to redo")
+	}
+}
+
+// uidTodos returns todos with a uid, from descriptions
+func uidTodos(descs ...string) []json.RawMessage {
+	todos := []json.RawMessage{}
+	for i, desc := range descs {
+		todos = append(todos, json.RawMessage(`{"id":`+strconv.Itoa(i+1)+`,"desc":"`+desc+`","uid":"uid-`+desc+`"}`))
+	}
+	return todos
+}
+
+func TestJournalKeepsChanges(t *testing.T) {
+	store := NewMemStore(t.Name())
+	store.Initialize()
+	journal, _ := OpenJournal(store)
+
+	steps := [][]json.RawMessage{
+		uidTodos("a", "b", "c"),
+		// b is changed
+		{uidTodos("a")[0], json.RawMessage(`{"id":2,"desc":"b","uid":"uid-b","status":"done"}`), uidTodos("a", "b", "c")[2]},
+		// a is removed and d added
+		{json.RawMessage(`{"id":2,"desc":"b","uid":"uid-b","status":"done"}`), uidTodos("a", "b", "c")[2], uidTodos("a", "b", "c", "d")[3]},
+		// the todos are moved
+		{uidTodos("a", "b", "c", "d")[3], json.RawMessage(`{"id":2,"desc":"b","uid":"uid-b","status":"done"}`), uidTodos("a", "b", "c")[2]},
+	}
+	store.Save(steps[0])
+	for i := 1; i < len(steps); i++ {
+		store.Save(steps[i])
+		if err := journal.Record(Entry{Command: "td", Before: steps[i-1], After: steps[i]}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	changed := journal.Entries[0]
+	if len(changed.Changes) != 1 || changed.Changes[0].UID != "uid-b" || changed.Before != nil || changed.BeforeOrder != nil {
+		t.Errorf("Expected only the todo changed to be kept, got %+v", changed)
+	}
+	if changes := journal.Entries[1].Changes; len(changes) != 2 || changes[0].After != nil || changes[1].Before != nil {
+		t.Errorf("Expected a todo removed and a todo added, got %+v", changes)
+	}
+	if moved := journal.Entries[2]; len(moved.Changes) != 0 || len(moved.AfterOrder) != 3 {
+		t.Errorf("Expected only the order of the todos moved, got %+v", moved)
+	}
+
+	for i := len(steps) - 2; i >= 0; i-- {
+		if _, err := journal.Undo(store); err != nil {
+			t.Fatal(err)
+		}
+		if err := sameTodos(store, steps[i]); err != nil {
+			t.Errorf("Expected the todos of the step %d once undone: %s", i, err)
+		}
+	}
+	for i := 1; i < len(steps); i++ {
+		if _, err := journal.Redo(store); err != nil {
+			t.Fatal(err)
+		}
+		if err := sameTodos(store, steps[i]); err != nil {
+			t.Errorf("Expected the todos of the step %d once redone: %s", i, err)
+		}
+	}
+
+	// a todo not changed by the command is changed outside of td
+	store.Save(uidTodos("d", "b", "x"))
+	if _, err := journal.Undo(store); err == nil {
+		t.Error("Expected a changed list to refuse the undo")
+	}
+}
+
+func TestUndoNothing(t *testing.T) {
+	store := NewMemStore(t.Name())
+	store.Initialize()
+	journal, _ := OpenJournal(store)
+	if _, err := journal.Undo(store); err == nil {
+		t.Error("Expected an empty journal to have nothing to undo")
+	}
+}
+
+func TestUndoRefusesExternalChanges(t *testing.T) {
+	store := NewFileStore(filepath.Join(t.TempDir(), FileName))
+	store.Initialize()
+	journal := recordCommands(t, store, 2)
+
+	// the file is written again with another layout, without changing the todos
+	if err := store.Save(journalTodos(2)); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := journal.Undo(store); err != nil {
+		t.Fatalf("Expected the layout of the file not to matter, got %s", err)
+	}
+	journal.Redo(store)
+
+	store.Save(journalTodos(3))
+	if _, err := journal.Undo(store); err == nil {
+		t.Fatal("Expected a changed file to refuse the undo")
+	}
+	if err := sameTodos(store, journalTodos(3)); err != nil {
+		t.Errorf("Expected the refused undo to leave the file as is: %s", err)
+	}
+}
+
+func TestJournalDepth(t *testing.T) {
+	defer os.Setenv(EnvJournalDepth, os.Getenv(EnvJournalDepth))
+
+	os.Setenv(EnvJournalDepth, "2")
+	store := NewMemStore(t.Name())
+	store.Initialize()
+	journal := recordCommands(t, store, 4)
+	if len(journal.Entries) != 2 || !sameRecords(journal.Entries[0].After, journalTodos(3)) {
+		t.Errorf("Expected only the last 2 entries to be kept, got %d", len(journal.Entries))
+	}
+
+	os.Setenv(EnvJournalDepth, "0")
+	store = NewMemStore(t.Name() + "-disabled")
+	store.Initialize()
+	if journal = recordCommands(t, store, 2); len(journal.Entries) != 0 {
+		t.Errorf("Expected a depth of 0 to disable the journal, got %d entries", len(journal.Entries))
+	}
+
+	os.Setenv(EnvJournalDepth, "many")
+	if err := journal.Record(Entry{After: journalTodos(1)}); err == nil {
+		t.Error("Expected an invalid depth to return an error")
+	}
+}
+
+func TestJournalFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), FileName)
+	store := NewFileStore(path)
+	store.Initialize()
+	recordCommands(t, store, 1)
+
+	content, err := ioutil.ReadFile(JournalPath(path))
+	if err != nil {
+		t.Fatalf("Expected the journal next to the database file: %s", err)
+	}
+
+	// the entries of another version of the format are dropped
+	var saved map[string]interface{}
+	json.Unmarshal(content, &saved)
+	saved["version"] = Version - 1
+	content, _ = json.Marshal(saved)
+	ioutil.WriteFile(JournalPath(path), content, 0600)
+	if journal, _ := OpenJournal(store); len(journal.Entries) != 0 {
+		t.Errorf("Expected the entries of another version to be dropped, got %d", len(journal.Entries))
+	}
+}
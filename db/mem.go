@@ -0,0 +1,122 @@
+package db
+
+import (
+	"encoding/json"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// memStores holds the content of the memory stores by name, so that every
+// MemStore with the same name within a process shares the same todos
+var memStores = struct {
+	sync.Mutex
+	todos map[string][]json.RawMessage
+	locks map[string]chan struct{}
+	// files are the files kept next to the stores, see sideFile
+	files map[string][]byte
+}{
+	todos: map[string][]json.RawMessage{},
+	locks: map[string]chan struct{}{},
+	files: map[string][]byte{},
+}
+
+// MemStore keeps the todos in memory, for the lifetime of the process
+type MemStore struct {
+	Name   string
+	locked bool
+}
+
+// NewMemStore returns the memory store named name
+func NewMemStore(name string) *MemStore {
+	memStores.Lock()
+	defer memStores.Unlock()
+	if _, ok := memStores.locks[name]; !ok {
+		memStores.locks[name] = make(chan struct{}, 1)
+	}
+	return &MemStore{Name: name}
+}
+
+// Check if the store has been initialized
+func (m *MemStore) Check() error {
+	memStores.Lock()
+	defer memStores.Unlock()
+	if _, ok := memStores.todos[m.Name]; !ok {
+		return fmt.Errorf("The memory store \"%s\" doesn't exists", m.Name)
+	}
+	return nil
+}
+
+// Initialize an empty store
+func (m *MemStore) Initialize() error {
+	memStores.Lock()
+	defer memStores.Unlock()
+	if _, ok := memStores.todos[m.Name]; ok {
+		return fmt.Errorf("%s: To-do store has been initialized before", m.Name)
+	}
+	memStores.todos[m.Name] = []json.RawMessage{}
+	return nil
+}
+
+// Lock the store, waiting up to TODO_LOCK_TIMEOUT
+func (m *MemStore) Lock() error {
+	if m.locked {
+		return nil
+	}
+	timeout, err := lockTimeout()
+	if err != nil {
+		return err
+	}
+
+	memStores.Lock()
+	lock := memStores.locks[m.Name]
+	memStores.Unlock()
+
+	select {
+	case lock <- struct{}{}:
+		m.locked = true
+		return nil
+	case <-time.After(timeout):
+		return fmt.Errorf("The memory store \"%s\" is locked", m.Name)
+	}
+}
+
+// Unlock release the lock taken by Lock
+func (m *MemStore) Unlock() error {
+	if !m.locked {
+		return nil
+	}
+	memStores.Lock()
+	lock := memStores.locks[m.Name]
+	memStores.Unlock()
+
+	m.locked = false
+	<-lock
+	return nil
+}
+
+// Load returns a copy of the todos
+func (m *MemStore) Load() ([]json.RawMessage, error) {
+	if err := m.Check(); err != nil {
+		return nil, err
+	}
+	memStores.Lock()
+	defer memStores.Unlock()
+	return copyTodos(memStores.todos[m.Name]), nil
+}
+
+// Save replaces the todos by a copy of todos
+func (m *MemStore) Save(todos []json.RawMessage) error {
+	memStores.Lock()
+	defer memStores.Unlock()
+	memStores.todos[m.Name] = copyTodos(todos)
+	return nil
+}
+
+func copyTodos(todos []json.RawMessage) []json.RawMessage {
+	copied := make([]json.RawMessage, len(todos))
+	for i, todo := range todos {
+		copied[i] = append(json.RawMessage(nil), todo...)
+	}
+	return copied
+}
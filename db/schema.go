@@ -0,0 +1,238 @@
+package db
+
+import (
+	"bytes"
+	"crypto/sha1"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Version of the format of the todos written by this version of td. Files
+// written by an older version are upgraded when they are loaded, files
+// written by a newer one are refused.
+//
+// History of the format:
+//  0. a bare JSON array of todos
+//  1. the array is wrapped in an envelope: {"version": 1, "todos": [...]}
+//  2. the timestamps of a todo (created, modified, started, completed) are
+//     RFC 3339 dates instead of the output of time.Time.String
+//  3. optional due date and priority of a todo
+//  4. tags of a todo, parsed from the hashtags of its description
+//  5. project of a todo, parsed from the +project of its description
+//  6. parent of a todo, the ID of the todo it is a subtask of
+//  7. dependencies of a todo, the IDs of the todos blocking it
+//  8. recurrence rule of a todo, adding its next occurrence once done
+//  9. notes of a todo, with the date they were added
+//  10. history of a todo, the changes with their date and author
+//  11. uid of a todo, an identifier kept when the todos are renumbered
+//
+// A new field of a todo bumps the version with an AddedFields migration, so
+// that an older td refuses to write the file instead of dropping the field.
+const Version = 11
+
+// Migration upgrades the todos from the format version From to From+1
+type Migration struct {
+	From        int
+	Description string
+	Migrate     func(todos []json.RawMessage) ([]json.RawMessage, error)
+}
+
+// migrations holds the registered migrations by the version they upgrade from
+var migrations = map[int]Migration{}
+
+// RegisterMigration adds a migration to the registry. Each version can only be
+// upgraded by one migration.
+func RegisterMigration(m Migration) {
+	if _, ok := migrations[m.From]; ok {
+		panic(fmt.Sprintf("a migration from the version %d is already registered", m.From))
+	}
+	migrations[m.From] = m
+}
+
+// Migrations returns the registered migrations, from the oldest version
+func Migrations() []Migration {
+	registered := make([]Migration, 0, len(migrations))
+	for _, m := range migrations {
+		registered = append(registered, m)
+	}
+	sort.Slice(registered, func(i, j int) bool { return registered[i].From < registered[j].From })
+	return registered
+}
+
+func init() {
+	RegisterMigration(Migration{
+		From:        0,
+		Description: "wrap the bare array of todos in a versioned envelope",
+		Migrate: func(todos []json.RawMessage) ([]json.RawMessage, error) {
+			return todos, nil
+		},
+	})
+	RegisterMigration(Migration{
+		From:        1,
+		Description: "store the modification date in RFC 3339, and use it as the start of wip todos and the completion of done ones",
+		Migrate: func(todos []json.RawMessage) ([]json.RawMessage, error) {
+			return mapTodos(todos, migrateTimestamps)
+		},
+	})
+	RegisterMigration(AddedFields(2, "due", "priority"))
+	RegisterMigration(AddedFields(3, "tags"))
+	RegisterMigration(AddedFields(4, "project"))
+	RegisterMigration(AddedFields(5, "parent"))
+	RegisterMigration(AddedFields(6, "depends"))
+	RegisterMigration(AddedFields(7, "recur"))
+	RegisterMigration(AddedFields(8, "notes"))
+	RegisterMigration(AddedFields(9, "history"))
+	RegisterMigration(Migration{
+		From:        10,
+		Description: "give each todo a uid, derived from its content so that it doesn't change until the file is written",
+		Migrate: func(todos []json.RawMessage) ([]json.RawMessage, error) {
+			return mapTodos(todos, migrateUID)
+		},
+	})
+}
+
+// AddedFields returns the migration of a version adding optional fields to
+// the todos: the todos of the previous version are left as they are.
+func AddedFields(from int, fields ...string) Migration {
+	return Migration{
+		From:        from,
+		Description: "add the optional fields " + strings.Join(fields, ", "),
+		Migrate: func(todos []json.RawMessage) ([]json.RawMessage, error) {
+			return todos, nil
+		},
+	}
+}
+
+// legacyTimeLayout is the layout of time.Time.String, without the monotonic clock reading
+const legacyTimeLayout = "2006-01-02 15:04:05.999999999 -0700 MST"
+
+func migrateTimestamps(todo map[string]interface{}) error {
+	legacy, _ := todo["modified"].(string)
+	delete(todo, "modified")
+	if i := strings.Index(legacy, " m="); i >= 0 {
+		legacy = legacy[:i]
+	}
+	modified, err := time.Parse(legacyTimeLayout, legacy)
+	if err != nil {
+		// an unreadable date is dropped rather than blocking the whole file
+		return nil
+	}
+
+	value := modified.Format(time.RFC3339)
+	todo["modified"] = value
+	switch todo["status"] {
+	case "wip":
+		todo["started"] = value
+	case "done":
+		todo["completed"] = value
+	}
+	return nil
+}
+
+func migrateUID(todo map[string]interface{}) error {
+	if uid, _ := todo["uid"].(string); uid != "" {
+		return nil
+	}
+	// the keys of a map are marshalled in order, whatever the layout of the file
+	content, err := json.Marshal(todo)
+	if err != nil {
+		return err
+	}
+	sum := sha1.Sum(content)
+	todo["uid"] = hex.EncodeToString(sum[:8])
+	return nil
+}
+
+// mapTodos applies a migration to each todo decoded as a generic JSON object
+func mapTodos(todos []json.RawMessage, migrate func(todo map[string]interface{}) error) ([]json.RawMessage, error) {
+	migrated := make([]json.RawMessage, len(todos))
+	for i, raw := range todos {
+		var todo map[string]interface{}
+		decoder := json.NewDecoder(bytes.NewReader(raw))
+		decoder.UseNumber()
+		if err := decoder.Decode(&todo); err != nil {
+			return nil, err
+		}
+		if err := migrate(todo); err != nil {
+			return nil, err
+		}
+		var err error
+		if migrated[i], err = json.Marshal(todo); err != nil {
+			return nil, err
+		}
+	}
+	return migrated, nil
+}
+
+// envelope is the content of a todos file since the version 1
+type envelope struct {
+	Version int               `json:"version"`
+	Todos   []json.RawMessage `json:"todos"`
+}
+
+// decode reads the todos of a file in any known version of the format and
+// returns them upgraded to Version
+func decode(content []byte) ([]json.RawMessage, error) {
+	todos, version, err := decodeVersion(content)
+	if err != nil {
+		return nil, err
+	}
+	if err := checkVersion(version); err != nil {
+		return nil, err
+	}
+	return upgrade(todos, version)
+}
+
+// decodeVersion reads the todos of a file without upgrading them
+func decodeVersion(content []byte) ([]json.RawMessage, int, error) {
+	content = bytes.TrimSpace(content)
+	if len(content) > 0 && content[0] == '[' {
+		var todos []json.RawMessage
+		err := json.Unmarshal(content, &todos)
+		return todos, 0, err
+	}
+
+	var e envelope
+	if err := json.Unmarshal(content, &e); err != nil {
+		return nil, 0, err
+	}
+	if e.Version < 1 {
+		return nil, 0, fmt.Errorf("The version %d of the to-do file is not valid", e.Version)
+	}
+	return e.Todos, e.Version, nil
+}
+
+// encode writes the todos in the current version of the format
+func encode(todos []json.RawMessage) ([]byte, error) {
+	if todos == nil {
+		todos = []json.RawMessage{}
+	}
+	return json.MarshalIndent(envelope{Version: Version, Todos: todos}, "", "  ")
+}
+
+// checkVersion refuses the files written by a newer version of td
+func checkVersion(version int) error {
+	if version > Version {
+		return fmt.Errorf("The to-do file has been written by a newer version of td (format %d, this td knows up to %d), please upgrade td", version, Version)
+	}
+	return nil
+}
+
+// upgrade applies the migrations from version to Version
+func upgrade(todos []json.RawMessage, version int) ([]json.RawMessage, error) {
+	for ; version < Version; version++ {
+		m, ok := migrations[version]
+		if !ok {
+			return nil, fmt.Errorf("No migration from the version %d of the to-do file", version)
+		}
+		var err error
+		if todos, err = m.Migrate(todos); err != nil {
+			return nil, fmt.Errorf("Migration from the version %d of the to-do file (%s): %s", version, m.Description, err)
+		}
+	}
+	return todos, nil
+}
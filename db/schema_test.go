@@ -0,0 +1,134 @@
+package db
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// fixtureStore copies a file of testdata in a temporary directory
+func fixtureStore(t *testing.T, name string) *FileStore {
+	content, err := ioutil.ReadFile(filepath.Join("testdata", name))
+	if err != nil {
+		t.Fatal(err)
+	}
+	store := NewFileStore(filepath.Join(t.TempDir(), FileName))
+	if err := ioutil.WriteFile(store.Path, content, 0600); err != nil {
+		t.Fatal(err)
+	}
+	return store
+}
+
+// fixtureTodos are the todos of every fixture, once upgraded to Version
+func fixtureTodos(t *testing.T) []json.RawMessage {
+	content, err := ioutil.ReadFile(filepath.Join("testdata", fmt.Sprintf("v%d.todos", Version)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var e envelope
+	if err := json.Unmarshal(content, &e); err != nil {
+		t.Fatal(err)
+	}
+	todos, err := upgrade(e.Todos, e.Version)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return todos
+}
+
+// equalTodos compares the todos as JSON values, ignoring the order of the fields
+func equalTodos(t *testing.T, store Store, expected []json.RawMessage) {
+	loaded, err := store.Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got, want interface{}
+	gotJSON, _ := json.Marshal(loaded)
+	wantJSON, _ := json.Marshal(expected)
+	json.Unmarshal(gotJSON, &got)
+	json.Unmarshal(wantJSON, &want)
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Expected todos %s, got %s", wantJSON, gotJSON)
+	}
+}
+
+func TestLoadHistoricalFormats(t *testing.T) {
+	for version := 0; version <= Version; version++ {
+		fixture := fmt.Sprintf("v%d.todos", version)
+		t.Run(fixture, func(t *testing.T) {
+			equalTodos(t, fixtureStore(t, fixture), fixtureTodos(t))
+		})
+	}
+}
+
+func TestSaveUpgradesFormat(t *testing.T) {
+	store := fixtureStore(t, "v0.todos")
+	todos, err := store.Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := store.Save(todos); err != nil {
+		t.Fatal(err)
+	}
+
+	content, _ := ioutil.ReadFile(store.Path)
+	_, version, err := decodeVersion(content)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if version != Version {
+		t.Errorf("Expected the file to be written in the version %d, got %d", Version, version)
+	}
+	equalTodos(t, store, fixtureTodos(t))
+}
+
+func TestRefuseNewerFormat(t *testing.T) {
+	store := fixtureStore(t, "newer.todos")
+	original, _ := ioutil.ReadFile(store.Path)
+
+	if _, err := store.Load(); err == nil || !strings.Contains(err.Error(), "newer version") {
+		t.Errorf("Expected loading a newer file to fail, got %v", err)
+	}
+	if err := store.Save(nil); err == nil {
+		t.Error("Expected writing over a newer file to fail")
+	}
+
+	content, _ := ioutil.ReadFile(store.Path)
+	if string(content) != string(original) {
+		t.Error("Expected the newer file to be left untouched")
+	}
+}
+
+func TestMigrationsRegistry(t *testing.T) {
+	registered := Migrations()
+	if len(registered) != Version {
+		t.Fatalf("Expected %d migrations, got %d", Version, len(registered))
+	}
+	for i, m := range registered {
+		if m.From != i {
+			t.Errorf("Expected a migration from the version %d, got one from %d", i, m.From)
+		}
+	}
+}
+
+func TestMigrateUIDKeepsExistingUID(t *testing.T) {
+	todo := map[string]interface{}{"id": 1, "uid": "5f1e0c2a9b3d4e6f"}
+	if err := migrateUID(todo); err != nil {
+		t.Fatal(err)
+	}
+	if todo["uid"] != "5f1e0c2a9b3d4e6f" {
+		t.Errorf("Expected the uid to be kept, got %v", todo["uid"])
+	}
+
+	first := map[string]interface{}{"id": 1, "desc": "Call mum"}
+	second := map[string]interface{}{"desc": "Call mum", "id": 1}
+	migrateUID(first)
+	migrateUID(second)
+	if first["uid"] == "" || first["uid"] != second["uid"] {
+		t.Errorf("Expected the same todos to get the same uid, got %v and %v", first["uid"], second["uid"])
+	}
+}
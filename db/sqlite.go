@@ -0,0 +1,422 @@
+package db
+
+import (
+	"bytes"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/deild/td/helper"
+	// pure Go driver, so that td still cross-compiles without cgo
+	_ "modernc.org/sqlite"
+)
+
+// sqliteHeader starts every SQLite database file
+const sqliteHeader = "SQLite format 3\x00"
+
+const sqliteSchema = `
+CREATE TABLE IF NOT EXISTS todos (
+	id       INTEGER NOT NULL,
+	position INTEGER NOT NULL,
+	status   TEXT NOT NULL DEFAULT '',
+	desc     TEXT NOT NULL DEFAULT '',
+	data     TEXT NOT NULL,
+	uid      TEXT NOT NULL DEFAULT ''
+);
+CREATE INDEX IF NOT EXISTS todos_id ON todos(id);
+CREATE INDEX IF NOT EXISTS todos_status ON todos(status);
+CREATE INDEX IF NOT EXISTS todos_position ON todos(position);
+CREATE INDEX IF NOT EXISTS todos_parent ON todos(json_extract(data, '$.parent'));
+CREATE TABLE IF NOT EXISTS history (
+	todo_id  INTEGER NOT NULL,
+	changed  TEXT NOT NULL,
+	action   TEXT NOT NULL,
+	data     TEXT NOT NULL,
+	todo_uid TEXT NOT NULL DEFAULT ''
+);
+`
+
+// uidColumns are the uid columns added to the tables of the databases
+// created before them, filled from the data of their rows. The history is
+// kept by uid, as the ids change when the todos are renumbered.
+var uidColumns = []struct {
+	table  string
+	column string
+	index  string
+}{
+	{"todos", "uid", "CREATE INDEX IF NOT EXISTS todos_uid ON todos(uid)"},
+	{"history", "todo_uid", "CREATE INDEX IF NOT EXISTS history_todo_uid ON history(todo_uid)"},
+}
+
+// SQLiteStore keeps the todos in a SQLite database, one row per todo, and
+// records every version of a todo replaced or removed by Save in a history table
+type SQLiteStore struct {
+	Path string
+	// lock is the lock file held between Lock and Unlock
+	lock *os.File
+}
+
+// NewSQLiteStore returns the store of the SQLite database at path
+func NewSQLiteStore(path string) *SQLiteStore {
+	return &SQLiteStore{Path: path}
+}
+
+// isSQLite tells if the file at path is a SQLite database
+func isSQLite(path string) bool {
+	file, err := os.Open(path)
+	if err != nil {
+		return false
+	}
+	defer file.Close()
+
+	header := make([]byte, len(sqliteHeader))
+	if _, err := io.ReadFull(file, header); err != nil {
+		return false
+	}
+	return string(header) == sqliteHeader
+}
+
+// Check if the database file exist
+func (s *SQLiteStore) Check() error {
+	return NewFileStore(s.Path).Check()
+}
+
+// Initialize the database file
+func (s *SQLiteStore) Initialize() error {
+	if _, err := os.Stat(s.Path); err == nil {
+		return fmt.Errorf("%s: To-do file has been initialized before", s.Path)
+	}
+	db, err := s.open()
+	if err != nil {
+		return err
+	}
+	return db.Close()
+}
+
+// Lock takes an exclusive advisory lock on the database file, the same way
+// FileStore does
+func (s *SQLiteStore) Lock() (err error) {
+	if s.lock == nil {
+		s.lock, err = lockFile(s.Path)
+	}
+	return err
+}
+
+// Unlock releases the lock taken by Lock
+func (s *SQLiteStore) Unlock() error {
+	if s.lock == nil {
+		return nil
+	}
+	file := s.lock
+	s.lock = nil
+	return release(file)
+}
+
+func (s *SQLiteStore) open() (*sql.DB, error) {
+	db, err := sql.Open("sqlite", s.Path)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := db.Exec(sqliteSchema); err != nil {
+		db.Close()
+		return nil, err
+	}
+	if err := addUIDColumns(db); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("%s: %s", s.Path, err)
+	}
+	if err := s.upgrade(db); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("%s: %s", s.Path, err)
+	}
+	return db, nil
+}
+
+// addUIDColumns adds the uidColumns missing, see uidColumns
+func addUIDColumns(db *sql.DB) error {
+	for _, added := range uidColumns {
+		var count int
+		err := db.QueryRow("SELECT COUNT(*) FROM pragma_table_info(?) WHERE name = ?", added.table, added.column).Scan(&count)
+		if err != nil {
+			return err
+		}
+		if count == 0 {
+			statements := []string{
+				fmt.Sprintf("ALTER TABLE %s ADD COLUMN %s TEXT NOT NULL DEFAULT ''", added.table, added.column),
+				fmt.Sprintf("UPDATE %s SET %s = COALESCE(json_extract(data, '$.uid'), '')", added.table, added.column),
+			}
+			for _, statement := range statements {
+				if _, err := db.Exec(statement); err != nil {
+					return err
+				}
+			}
+		}
+		if _, err := db.Exec(added.index); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// upgrade applies the migrations to the todos of a database written by an
+// older version of td. The version of the format is kept in the user_version
+// pragma; SQLite databases started with the version 1.
+func (s *SQLiteStore) upgrade(db *sql.DB) error {
+	var version int
+	if err := db.QueryRow("PRAGMA user_version").Scan(&version); err != nil {
+		return err
+	}
+	if version == Version {
+		return nil
+	}
+	if version == 0 {
+		version = 1
+	}
+	if err := checkVersion(version); err != nil {
+		return err
+	}
+
+	if version < Version {
+		todos, err := query(db, Filter{})
+		if err != nil {
+			return err
+		}
+		if todos, err = upgrade(todos, version); err != nil {
+			return err
+		}
+		if err = save(db, todos); err != nil {
+			return err
+		}
+	}
+	_, err := db.Exec(fmt.Sprintf("PRAGMA user_version = %d", Version))
+	return err
+}
+
+// Load returns all the todos, in order
+func (s *SQLiteStore) Load() ([]json.RawMessage, error) {
+	return s.Query(Filter{})
+}
+
+// Query returns the todos matching filter, in order, using the indexes of the database
+func (s *SQLiteStore) Query(filter Filter) ([]json.RawMessage, error) {
+	db, err := s.open()
+	if err != nil {
+		return nil, err
+	}
+	defer helper.Check(db.Close)
+	return query(db, filter)
+}
+
+func query(db *sql.DB, filter Filter) ([]json.RawMessage, error) {
+	var where []string
+	var args []interface{}
+	if len(filter.IDs) > 0 {
+		where = append(where, "id IN ("+placeholders(len(filter.IDs))+")")
+		for _, id := range filter.IDs {
+			args = append(args, id)
+		}
+	}
+	if len(filter.Statuses) > 0 {
+		where = append(where, "status IN ("+placeholders(len(filter.Statuses))+")")
+		for _, status := range filter.Statuses {
+			args = append(args, status)
+		}
+	}
+	if len(filter.ExcludedStatuses) > 0 {
+		where = append(where, "status NOT IN ("+placeholders(len(filter.ExcludedStatuses))+")")
+		for _, status := range filter.ExcludedStatuses {
+			args = append(args, status)
+		}
+	}
+	if len(filter.Parents) > 0 {
+		where = append(where, "json_extract(data, '$.parent') IN ("+placeholders(len(filter.Parents))+")")
+		for _, id := range filter.Parents {
+			args = append(args, id)
+		}
+	}
+	if filter.Text != "" && filter.Notes {
+		where = append(where, `(desc LIKE ? ESCAPE '\' OR EXISTS (SELECT 1 FROM json_each(data, '$.notes') WHERE json_extract(value, '$.text') LIKE ? ESCAPE '\'))`)
+		pattern := "%" + likeEscaper.Replace(filter.Text) + "%"
+		args = append(args, pattern, pattern)
+	} else if filter.Text != "" {
+		where = append(where, `desc LIKE ? ESCAPE '\'`)
+		args = append(args, "%"+likeEscaper.Replace(filter.Text)+"%")
+	}
+
+	query := "SELECT data FROM todos"
+	if len(where) > 0 {
+		query += " WHERE " + strings.Join(where, " AND ")
+	}
+	rows, err := db.Query(query+" ORDER BY position", args...)
+	if err != nil {
+		return nil, err
+	}
+	defer helper.Check(rows.Close)
+
+	todos := []json.RawMessage{}
+	for rows.Next() {
+		var data string
+		if err := rows.Scan(&data); err != nil {
+			return nil, err
+		}
+		todos = append(todos, json.RawMessage(data))
+	}
+	return todos, rows.Err()
+}
+
+var likeEscaper = strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`)
+
+func placeholders(n int) string {
+	return strings.TrimSuffix(strings.Repeat("?,", n), ",")
+}
+
+// row is a todo as stored in the todos table
+type row struct {
+	rowid    int64
+	id       int64
+	uid      string
+	position int
+	data     string
+}
+
+// todoColumns are the fields of a todo copied in their own indexed columns
+type todoColumns struct {
+	ID     int64  `json:"id"`
+	Status string `json:"status"`
+	Desc   string `json:"desc"`
+	UID    string `json:"uid"`
+}
+
+// key returns the key of the row of a todo: its uid, or its id when it has
+// none
+func (c todoColumns) key() string {
+	if c.UID != "" {
+		return c.UID
+	}
+	return fmt.Sprintf("#%d", c.ID)
+}
+
+// Save replaces all the todos. Only the rows of the todos which changed are
+// written, and their previous version goes to the history table.
+func (s *SQLiteStore) Save(todos []json.RawMessage) error {
+	db, err := s.open()
+	if err != nil {
+		return err
+	}
+	defer helper.Check(db.Close)
+	return save(db, todos)
+}
+
+func save(db *sql.DB, todos []json.RawMessage) (err error) {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err != nil {
+			tx.Rollback()
+			return
+		}
+		err = tx.Commit()
+	}()
+
+	existing, err := existingRows(tx)
+	if err != nil {
+		return err
+	}
+
+	changed := time.Now().UTC().Format(time.RFC3339Nano)
+	for position, todo := range todos {
+		var compact bytes.Buffer
+		if err = json.Compact(&compact, todo); err != nil {
+			return err
+		}
+		data := compact.String()
+		var columns todoColumns
+		if err = json.Unmarshal(todo, &columns); err != nil {
+			return err
+		}
+
+		old, ok := existing[columns.key()]
+		switch {
+		case !ok:
+			_, err = tx.Exec("INSERT INTO todos (id, position, status, desc, data, uid) VALUES (?, ?, ?, ?, ?, ?)",
+				columns.ID, position, columns.Status, columns.Desc, data, columns.UID)
+			if err == nil {
+				err = addHistory(tx, columns.ID, columns.UID, changed, "created", data)
+			}
+		case old.data != data:
+			_, err = tx.Exec("UPDATE todos SET id = ?, position = ?, status = ?, desc = ?, data = ? WHERE rowid = ?",
+				columns.ID, position, columns.Status, columns.Desc, data, old.rowid)
+			if err == nil {
+				err = addHistory(tx, columns.ID, columns.UID, changed, "updated", old.data)
+			}
+		case old.position != position:
+			_, err = tx.Exec("UPDATE todos SET position = ? WHERE rowid = ?", position, old.rowid)
+		}
+		if err != nil {
+			return err
+		}
+		delete(existing, columns.key())
+	}
+
+	for _, old := range existing {
+		if _, err = tx.Exec("DELETE FROM todos WHERE rowid = ?", old.rowid); err != nil {
+			return err
+		}
+		if err = addHistory(tx, old.id, old.uid, changed, "deleted", old.data); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// existingRows returns the rows of the todos table by key, see todoColumns.
+// A duplicated key can't be matched with the new todos: all its rows are
+// then removed and the todos are inserted again.
+func existingRows(tx *sql.Tx) (map[string]row, error) {
+	rows, err := tx.Query("SELECT rowid, id, uid, position, data FROM todos")
+	if err != nil {
+		return nil, err
+	}
+	defer helper.Check(rows.Close)
+
+	existing := map[string]row{}
+	duplicated := map[string]row{}
+	for rows.Next() {
+		var r row
+		if err := rows.Scan(&r.rowid, &r.id, &r.uid, &r.position, &r.data); err != nil {
+			return nil, err
+		}
+		key := todoColumns{ID: r.id, UID: r.uid}.key()
+		if _, ok := existing[key]; ok {
+			duplicated[key] = r
+		}
+		existing[key] = r
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	for key, r := range duplicated {
+		statement, arg := "DELETE FROM todos WHERE uid = ?", interface{}(r.uid)
+		if r.uid == "" {
+			statement, arg = "DELETE FROM todos WHERE uid = '' AND id = ?", r.id
+		}
+		if _, err := tx.Exec(statement, arg); err != nil {
+			return nil, err
+		}
+		delete(existing, key)
+	}
+	return existing, nil
+}
+
+func addHistory(tx *sql.Tx, id int64, uid string, changed string, action string, data string) error {
+	_, err := tx.Exec("INSERT INTO history (todo_id, todo_uid, changed, action, data) VALUES (?, ?, ?, ?, ?)",
+		id, uid, changed, action, data)
+	return err
+}
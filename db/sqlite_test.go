@@ -0,0 +1,206 @@
+package db
+
+import (
+	"database/sql"
+	"encoding/json"
+	"io/ioutil"
+	"path/filepath"
+	"strconv"
+	"testing"
+)
+
+func sqliteTodos() []json.RawMessage {
+	return []json.RawMessage{
+		json.RawMessage(`{"id":1,"desc":"Call mum #family","status":"pending","extra":[1,2]}`),
+		json.RawMessage(`{"id":2,"desc":"Write 100% of the tests","status":"wip","notes":[{"created":"2018-05-25T10:00:00Z","text":"Ask the plumber"}]}`),
+		json.RawMessage(`{"id":3,"desc":"Call the bank","status":"done"}`),
+	}
+}
+
+func TestSQLiteSaveAndLoad(t *testing.T) {
+	store := NewSQLiteStore(filepath.Join(t.TempDir(), FileName))
+	if err := store.Initialize(); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.Check(); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.Save(sqliteTodos()); err != nil {
+		t.Fatal(err)
+	}
+	if err := sameTodos(store, sqliteTodos()); err != nil {
+		t.Error(err)
+	}
+
+	reordered := []json.RawMessage{sqliteTodos()[2], sqliteTodos()[0]}
+	if err := store.Save(reordered); err != nil {
+		t.Fatal(err)
+	}
+	if err := sameTodos(store, reordered); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestSQLiteQuery(t *testing.T) {
+	store := NewSQLiteStore(filepath.Join(t.TempDir(), FileName))
+	store.Save(sqliteTodos())
+
+	cases := []struct {
+		filter   Filter
+		expected int
+	}{
+		{Filter{}, 3},
+		{Filter{IDs: []int64{2, 3}}, 2},
+		{Filter{Statuses: []string{"wip"}}, 1},
+		{Filter{ExcludedStatuses: []string{"done"}}, 2},
+		{Filter{Text: "call"}, 2},
+		{Filter{Text: "100%"}, 1},
+		{Filter{Text: "call", ExcludedStatuses: []string{"done"}}, 1},
+		{Filter{Text: "plumber"}, 0},
+		{Filter{Text: "plumber", Notes: true}, 1},
+		{Filter{Text: "CALL", Notes: true}, 2},
+	}
+	for _, c := range cases {
+		todos, err := store.Query(c.filter)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(todos) != c.expected {
+			t.Errorf("Expected %d todos for %+v, got %d", c.expected, c.filter, len(todos))
+		}
+	}
+}
+
+func TestSQLiteHistory(t *testing.T) {
+	store := NewSQLiteStore(filepath.Join(t.TempDir(), FileName))
+	store.Save(sqliteTodos())
+	todos := sqliteTodos()
+	todos[1] = json.RawMessage(`{"id":2,"desc":"Write 100% of the tests","status":"done"}`)
+	store.Save(todos[:2])
+
+	db, _ := sql.Open("sqlite", store.Path)
+	defer db.Close()
+	var actions []string
+	rows, err := db.Query("SELECT action FROM history ORDER BY rowid")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for rows.Next() {
+		var action string
+		rows.Scan(&action)
+		actions = append(actions, action)
+	}
+	rows.Close()
+
+	expected := []string{"created", "created", "created", "updated", "deleted"}
+	if len(actions) != len(expected) {
+		t.Fatalf("Expected history %v, got %v", expected, actions)
+	}
+	for i := range expected {
+		if actions[i] != expected[i] {
+			t.Errorf("Expected history %v, got %v", expected, actions)
+		}
+	}
+}
+
+// historyOf returns the actions of the history of a todo, by its uid
+func historyOf(t *testing.T, path string, uid string) []string {
+	db, _ := sql.Open("sqlite", path)
+	defer db.Close()
+	rows, err := db.Query("SELECT action FROM history WHERE todo_uid = ? ORDER BY rowid", uid)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rows.Close()
+	var actions []string
+	for rows.Next() {
+		var action string
+		rows.Scan(&action)
+		actions = append(actions, action)
+	}
+	return actions
+}
+
+func TestSQLiteHistoryFollowsRenumbering(t *testing.T) {
+	store := NewSQLiteStore(filepath.Join(t.TempDir(), FileName))
+	store.Save([]json.RawMessage{
+		json.RawMessage(`{"id":1,"desc":"first","uid":"aaaa"}`),
+		json.RawMessage(`{"id":2,"desc":"second","uid":"bbbb"}`),
+	})
+	// the todos are swapped
+	store.Save([]json.RawMessage{
+		json.RawMessage(`{"id":1,"desc":"second","uid":"bbbb"}`),
+		json.RawMessage(`{"id":2,"desc":"first","uid":"aaaa"}`),
+	})
+
+	if actions := historyOf(t, store.Path, "aaaa"); len(actions) != 2 || actions[1] != "updated" {
+		t.Errorf("Expected the todo renumbered to be updated, got %v", actions)
+	}
+	todos, _ := store.Query(Filter{IDs: []int64{2}})
+	if len(todos) != 1 || uidOf(todos[0]) != "aaaa" {
+		t.Errorf("Expected the id of the todo to follow its renumbering, got %d todos", len(todos))
+	}
+}
+
+func TestSQLiteAddsUIDColumns(t *testing.T) {
+	path := filepath.Join(t.TempDir(), FileName)
+	db, _ := sql.Open("sqlite", path)
+	for _, statement := range []string{
+		"CREATE TABLE todos (id INTEGER NOT NULL, position INTEGER NOT NULL, status TEXT NOT NULL DEFAULT '', desc TEXT NOT NULL DEFAULT '', data TEXT NOT NULL)",
+		"CREATE TABLE history (todo_id INTEGER NOT NULL, changed TEXT NOT NULL, action TEXT NOT NULL, data TEXT NOT NULL)",
+		`INSERT INTO todos VALUES (1, 0, 'pending', 'first', '{"id":1,"desc":"first","uid":"aaaa"}')`,
+		`INSERT INTO history VALUES (1, '2018-06-01T10:00:00Z', 'created', '{"id":1,"desc":"first","uid":"aaaa"}')`,
+		"PRAGMA user_version = " + strconv.Itoa(Version),
+	} {
+		if _, err := db.Exec(statement); err != nil {
+			t.Fatal(err)
+		}
+	}
+	db.Close()
+
+	store := NewSQLiteStore(path)
+	if err := store.Save([]json.RawMessage{json.RawMessage(`{"id":1,"desc":"first done","uid":"aaaa"}`)}); err != nil {
+		t.Fatal(err)
+	}
+	if actions := historyOf(t, path, "aaaa"); len(actions) != 2 || actions[1] != "updated" {
+		t.Errorf("Expected the history of the todo to be kept by uid, got %v", actions)
+	}
+}
+
+func TestConvert(t *testing.T) {
+	path := filepath.Join(t.TempDir(), FileName)
+	file := NewFileStore(path)
+	file.Initialize()
+	file.Save(sqliteTodos())
+
+	backup, err := Convert(path, FormatSQLite)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if backup != path+".bak.json" {
+		t.Errorf("Expected the JSON file to be kept as a backup, got \"%s\"", backup)
+	}
+	store, _ := OpenStore(path)
+	if _, ok := store.(*SQLiteStore); !ok {
+		t.Fatalf("Expected the file to be a SQLite database, got %#v", store)
+	}
+	if err := sameTodos(store, sqliteTodos()); err != nil {
+		t.Error(err)
+	}
+
+	if _, err := Convert(path, FormatSQLite); err == nil {
+		t.Error("Expected converting to the same format to fail")
+	}
+
+	if _, err := Convert(path, FormatJSON); err != nil {
+		t.Fatal(err)
+	}
+	content, _ := ioutil.ReadFile(path)
+	var e envelope
+	if err := json.Unmarshal(content, &e); err != nil || e.Version != Version {
+		t.Fatal("Expected a JSON file after the conversion back", err)
+	}
+	if err := sameTodos(NewFileStore(path), sqliteTodos()); err != nil {
+		t.Error(err)
+	}
+}
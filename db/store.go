@@ -0,0 +1,164 @@
+package db
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"os"
+	"strings"
+)
+
+// Store is where the todos are kept. A store handles each todo as a JSON
+// document, so it doesn't depend on the structure of a todo.
+type Store interface {
+	// Check if the store exist
+	Check() error
+	// Initialize an empty store
+	Initialize() error
+	// Lock the store until Unlock is called, for every process sharing it
+	Lock() error
+	// Unlock release the lock taken by Lock
+	Unlock() error
+	// Load returns all the todos, in order
+	Load() ([]json.RawMessage, error)
+	// Save replaces all the todos
+	Save(todos []json.RawMessage) error
+}
+
+// Filter selects todos in a Querier. Every non empty field must match.
+type Filter struct {
+	IDs              []int64
+	Statuses         []string
+	ExcludedStatuses []string
+	// Parents selects the subtasks of these todos
+	Parents []int64
+	// Text is searched in the description, ignoring the case of the ASCII
+	// letters only with a SQLite database
+	Text string
+	// Notes searches Text in the notes of the todos too
+	Notes bool
+}
+
+// Querier is implemented by the stores able to select todos without loading
+// all of them
+type Querier interface {
+	// Query returns the todos matching filter, in order
+	Query(filter Filter) ([]json.RawMessage, error)
+}
+
+// OpenStore returns the store for a location, which is either a file path or
+// an URL: file:///home/me/.todos, sqlite:///home/me/.todos, mem://name.
+// A file path holding a SQLite database opens a SQLiteStore.
+func OpenStore(location string) (Store, error) {
+	if !strings.Contains(location, "://") {
+		if isSQLite(location) {
+			return NewSQLiteStore(location), nil
+		}
+		return NewFileStore(location), nil
+	}
+
+	u, err := url.Parse(location)
+	if err != nil {
+		return nil, err
+	}
+
+	switch u.Scheme {
+	case "file":
+		return NewFileStore(u.Path), nil
+	case "sqlite":
+		return NewSQLiteStore(u.Path), nil
+	case "mem":
+		return NewMemStore(u.Host + u.Path), nil
+	default:
+		return nil, fmt.Errorf("%s: the storage \"%s\" is not supported", location, u.Scheme)
+	}
+}
+
+// Formats of the files handled by Convert
+const (
+	FormatJSON   = "json"
+	FormatSQLite = "sqlite"
+)
+
+// Convert rewrites the todos file at path in another format, in place. The
+// previous file is kept as path.bak.<previous format>, whose name is returned.
+// The caller must hold the lock of the file.
+func Convert(path string, format string) (backup string, err error) {
+	from, err := OpenStore(path)
+	if err != nil {
+		return "", err
+	}
+	fromFormat := FormatJSON
+	if _, ok := from.(*SQLiteStore); ok {
+		fromFormat = FormatSQLite
+	}
+	if fromFormat == format {
+		return "", fmt.Errorf("%s: To-do file is already stored as %s", path, format)
+	}
+
+	tmp := path + ".convert"
+	var to Store
+	switch format {
+	case FormatJSON:
+		to = NewFileStore(tmp)
+	case FormatSQLite:
+		to = NewSQLiteStore(tmp)
+	default:
+		return "", fmt.Errorf("The format \"%s\" is not supported, use %s or %s", format, FormatJSON, FormatSQLite)
+	}
+	os.Remove(tmp)
+	defer func() {
+		if err != nil {
+			os.Remove(tmp)
+		}
+	}()
+
+	todos, err := from.Load()
+	if err != nil {
+		return "", err
+	}
+	if err = to.Initialize(); err != nil {
+		return "", err
+	}
+	if err = to.Save(todos); err != nil {
+		return "", err
+	}
+	if err = sameTodos(to, todos); err != nil {
+		return "", err
+	}
+
+	backup = path + ".bak." + fromFormat
+	if err = os.Rename(path, backup); err != nil {
+		return "", err
+	}
+	if err = os.Rename(tmp, path); err != nil {
+		os.Rename(backup, path)
+		return "", err
+	}
+	return backup, nil
+}
+
+// sameTodos checks that store holds exactly todos
+func sameTodos(store Store, todos []json.RawMessage) error {
+	loaded, err := store.Load()
+	if err != nil {
+		return err
+	}
+	if len(loaded) != len(todos) {
+		return fmt.Errorf("The conversion lost todos: %d instead of %d", len(loaded), len(todos))
+	}
+	for i := range todos {
+		var expected, got bytes.Buffer
+		if err := json.Compact(&expected, todos[i]); err != nil {
+			return err
+		}
+		if err := json.Compact(&got, loaded[i]); err != nil {
+			return err
+		}
+		if expected.String() != got.String() {
+			return fmt.Errorf("The conversion changed a todo: %s instead of %s", got.String(), expected.String())
+		}
+	}
+	return nil
+}
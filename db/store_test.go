@@ -0,0 +1,78 @@
+package db
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestOpenStore(t *testing.T) {
+	cases := map[string]string{
+		"/home/me/.todos":        "/home/me/.todos",
+		"file:///home/me/.todos": "/home/me/.todos",
+	}
+	for location, expected := range cases {
+		store, err := OpenStore(location)
+		if err != nil {
+			t.Fatal(err)
+		}
+		file, ok := store.(*FileStore)
+		if !ok || file.Path != expected {
+			t.Errorf("Expected \"%s\" to open the file \"%s\", got %#v", location, expected, store)
+		}
+	}
+
+	store, err := OpenStore("mem://test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if mem, ok := store.(*MemStore); !ok || mem.Name != "test" {
+		t.Errorf("Expected a memory store named \"test\", got %#v", store)
+	}
+
+	if _, err := OpenStore("ftp://example.com/.todos"); err == nil {
+		t.Error("Expected an unsupported storage to return an error")
+	}
+}
+
+func TestMemStore(t *testing.T) {
+	store := NewMemStore(t.Name())
+	if store.Check() == nil {
+		t.Error("Expected an uninitialized store to fail the check")
+	}
+	if err := store.Initialize(); err != nil {
+		t.Fatal(err)
+	}
+	if store.Initialize() == nil {
+		t.Error("Expected a second initialization to fail")
+	}
+
+	todos := []json.RawMessage{json.RawMessage(`{"id":1}`)}
+	if err := store.Save(todos); err != nil {
+		t.Fatal(err)
+	}
+	todos[0][6] = '2'
+
+	loaded, err := NewMemStore(t.Name()).Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(loaded) != 1 || string(loaded[0]) != `{"id":1}` {
+		t.Errorf("Expected the saved todos to be shared by name, got %s", loaded)
+	}
+}
+
+func TestMemStoreLock(t *testing.T) {
+	t.Setenv(EnvLockTimeout, "10ms")
+	first, second := NewMemStore(t.Name()), NewMemStore(t.Name())
+	if err := first.Lock(); err != nil {
+		t.Fatal(err)
+	}
+	if second.Lock() == nil {
+		t.Error("Expected the store to be locked")
+	}
+	first.Unlock()
+	if err := second.Lock(); err != nil {
+		t.Errorf("Expected the store to be unlocked, got %s", err)
+	}
+	second.Unlock()
+}
@@ -0,0 +1,52 @@
+package db
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+)
+
+// Views are the queries saved by name for a store, see td view
+type Views struct {
+	Queries map[string]string `json:"views"`
+	// Default is the name of the view listed by td without arguments
+	Default string `json:"default,omitempty"`
+	// write saves the encoded views
+	write func(content []byte) error
+}
+
+// ViewsPath returns the path of the views of a database file
+func ViewsPath(target string) string {
+	return target + ".views"
+}
+
+// OpenViews returns the views of a store, see sideFile
+func OpenViews(store Store) (*Views, error) {
+	content, write, ok, err := sideFile(store, ViewsPath)
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		return nil, errors.New("This storage has no views")
+	}
+
+	views := &Views{write: write}
+	if len(content) > 0 {
+		if err := json.Unmarshal(content, views); err != nil {
+			return nil, fmt.Errorf("The views are not valid: %s", err)
+		}
+	}
+	if views.Queries == nil {
+		views.Queries = map[string]string{}
+	}
+	return views, nil
+}
+
+// Save writes the views
+func (v *Views) Save() error {
+	content, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return err
+	}
+	return v.write(content)
+}
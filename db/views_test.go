@@ -0,0 +1,41 @@
+package db
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestViewsFile(t *testing.T) {
+	store := NewFileStore(filepath.Join(t.TempDir(), FileName))
+	store.Initialize()
+
+	views, err := OpenViews(store)
+	if err != nil || len(views.Queries) != 0 {
+		t.Fatalf("Expected no view before the first one is saved, got %+v (%v)", views, err)
+	}
+	views.Queries["standup"] = "status:wip"
+	views.Default = "standup"
+	if err := views.Save(); err != nil {
+		t.Fatal(err)
+	}
+
+	views, err = OpenViews(NewFileStore(store.Path))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if views.Queries["standup"] != "status:wip" || views.Default != "standup" {
+		t.Errorf("Expected the views to be read from %s, got %+v", ViewsPath(store.Path), views)
+	}
+}
+
+func TestUnreadableViews(t *testing.T) {
+	store := NewFileStore(filepath.Join(t.TempDir(), FileName))
+	store.Initialize()
+
+	// the views can't be read, they must not look empty and be overwritten
+	os.Mkdir(ViewsPath(store.Path), 0700)
+	if _, err := OpenViews(store); err == nil {
+		t.Error("Expected views which can't be read to return an error")
+	}
+}
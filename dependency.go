@@ -0,0 +1,197 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/deild/td/db"
+)
+
+// Block makes a todo depend on other todos: it is blocked until they are all
+// done. A dependency creating a cycle is refused.
+func (c *Collection) Block(id int64, on []int64) (*Todo, error) {
+	todo, err := c.Find(id)
+	if err != nil {
+		return todo, err
+	}
+
+	for _, dependency := range on {
+		if dependency == id {
+			return todo, fmt.Errorf("The todo %d can't be blocked by itself.", id)
+		}
+		if _, err = c.Find(dependency); err != nil {
+			return todo, err
+		}
+		if path := c.dependencyPath(dependency, id); path != nil {
+			return todo, fmt.Errorf("The todo %d can't be blocked by %d, it would create the cycle %s.", id, dependency, cycleText(append([]int64{id}, path...)))
+		}
+	}
+
+	before := joinIDs(todo.DependsOn)
+	for _, dependency := range on {
+		if !todo.DependsOnID(dependency) {
+			todo.DependsOn = append(todo.DependsOn, dependency)
+		}
+	}
+	c.dependsChanged(todo, before)
+
+	return todo, err
+}
+
+// Unblock removes dependencies of a todo, all of them when on is empty
+func (c *Collection) Unblock(id int64, on []int64) (*Todo, error) {
+	todo, err := c.Find(id)
+	if err != nil {
+		return todo, err
+	}
+
+	for _, dependency := range on {
+		if !todo.DependsOnID(dependency) {
+			return todo, fmt.Errorf("The todo %d is not blocked by %d.", id, dependency)
+		}
+	}
+
+	before := joinIDs(todo.DependsOn)
+	if len(on) == 0 {
+		todo.DependsOn = nil
+	}
+	for _, dependency := range on {
+		todo.DependsOn = removeID(todo.DependsOn, dependency)
+	}
+	c.dependsChanged(todo, before)
+
+	return todo, err
+}
+
+// dependsChanged records the change of the dependencies of a todo
+func (c *Collection) dependsChanged(todo *Todo, before string) {
+	now := c.now()
+	if after := joinIDs(todo.DependsOn); after != before {
+		c.record(todo, now, EventDepends, before, after)
+	}
+	todo.Modified = now
+}
+
+// DependsOnID tells if the todo is blocked by the todo id
+func (t *Todo) DependsOnID(id int64) bool {
+	for _, dependency := range t.DependsOn {
+		if dependency == id {
+			return true
+		}
+	}
+	return false
+}
+
+// dependencyPath returns the todos leading from the todo from to the todo to
+// through their dependencies, or nil when to can't be reached
+func (c *Collection) dependencyPath(from int64, to int64) []int64 {
+	previous := map[int64]int64{from: 0}
+	queue := []int64{from}
+	for len(queue) > 0 {
+		id := queue[0]
+		queue = queue[1:]
+		if id == to {
+			var path []int64
+			for ; id != 0; id = previous[id] {
+				path = append([]int64{id}, path...)
+			}
+			return path
+		}
+		todo, err := c.Find(id)
+		if err != nil {
+			continue
+		}
+		for _, dependency := range todo.DependsOn {
+			if _, ok := previous[dependency]; !ok {
+				previous[dependency] = id
+				queue = append(queue, dependency)
+			}
+		}
+	}
+	return nil
+}
+
+// Blockers returns, for each blocked todo, the IDs of the todos it waits for.
+// When the collection holds only a selection of the todos, the dependencies
+// are queried from the store.
+func (c *Collection) Blockers() (map[int64][]int64, error) {
+	status := map[int64]string{}
+	var missing []int64
+	for _, todo := range c.Todos {
+		status[todo.ID] = todo.Status
+	}
+	for _, todo := range c.Todos {
+		for _, dependency := range todo.DependsOn {
+			if _, ok := status[dependency]; !ok {
+				missing = append(missing, dependency)
+			}
+		}
+	}
+
+	if querier, ok := c.store.(db.Querier); ok && c.partial && len(missing) > 0 {
+		dependencies, err := c.query(querier, db.Filter{IDs: missing})
+		if err != nil {
+			return nil, err
+		}
+		for _, todo := range dependencies {
+			status[todo.ID] = todo.Status
+		}
+	}
+
+	blockers := map[int64][]int64{}
+	for _, todo := range c.Todos {
+		for _, dependency := range todo.DependsOn {
+			// a dependency no longer in the list doesn't block anything
+			if s, ok := status[dependency]; ok && !statusOf(s).Finished {
+				blockers[todo.ID] = append(blockers[todo.ID], dependency)
+			}
+		}
+	}
+	return blockers, nil
+}
+
+// ListActionableTodos keep only the todos not done and not blocked, by a
+// dependency or by subtasks not finished yet
+func (c *Collection) ListActionableTodos() error {
+	blockers, err := c.Blockers()
+	if err != nil {
+		return err
+	}
+	// the subtasks are looked for before any todo is removed
+	parents := make(map[int64]bool)
+	for _, todo := range c.Todos {
+		if c.hasUnfinishedDescendant(todo.ID) {
+			parents[todo.ID] = true
+		}
+	}
+	for i := len(c.Todos) - 1; i >= 0; i-- {
+		todo := c.Todos[i]
+		if todo.IsFinished() || len(blockers[todo.ID]) > 0 || parents[todo.ID] {
+			c.RemoveAtIndex(i)
+		}
+	}
+	return nil
+}
+
+// removeID returns ids without id
+func removeID(ids []int64, id int64) []int64 {
+	kept := ids[:0]
+	for _, other := range ids {
+		if other != id {
+			kept = append(kept, other)
+		}
+	}
+	if len(kept) == 0 {
+		return nil
+	}
+	return kept
+}
+
+// cycleText writes a cycle of dependencies like "4 -> 7 -> 4"
+func cycleText(path []int64) string {
+	ids := make([]string, len(path))
+	for i, id := range path {
+		ids[i] = fmt.Sprint(id)
+	}
+	return strings.Join(ids, " -> ")
+}
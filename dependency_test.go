@@ -0,0 +1,176 @@
+package main
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/deild/td/db"
+)
+
+// dependencyCollection holds "Deploy" blocked by "Test" and "Review"
+func dependencyCollection() Collection {
+	collection, _ := collectionFromTaskDesk([]string{"Write", "Test", "Review", "Deploy"})
+	collection.Todos[3].DependsOn = []int64{2, 3}
+	return collection
+}
+
+func dependsOf(t *testing.T, collection Collection, desc string) []int64 {
+	for _, todo := range collection.Todos {
+		if todo.Desc == desc {
+			return todo.DependsOn
+		}
+	}
+	t.Fatalf("The todo \"%s\" was not found", desc)
+	return nil
+}
+
+func TestBlock(t *testing.T) {
+	collection := dependencyCollection()
+	todo, err := collection.Block(4, []int64{1, 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if joinIDs(todo.DependsOn) != "2, 3, 1" {
+		t.Errorf("Expected the todo to be blocked by 2, 3 and 1, got %v", todo.DependsOn)
+	}
+
+	if _, err := collection.Block(4, []int64{4}); err == nil {
+		t.Error("Expected a todo blocked by itself to fail")
+	}
+	if _, err := collection.Block(4, []int64{9}); err == nil {
+		t.Error("Expected a todo blocked by a missing todo to fail")
+	}
+}
+
+func TestBlockRefusesCycles(t *testing.T) {
+	collection := dependencyCollection()
+	collection.Todos[1].DependsOn = []int64{1}
+
+	_, err := collection.Block(1, []int64{4})
+	if err == nil {
+		t.Fatal("Expected a cycle of dependencies to fail")
+	}
+	if !strings.Contains(err.Error(), "1 -> 4 -> 2 -> 1") {
+		t.Errorf("Expected the error to show the cycle, got \"%s\"", err)
+	}
+	if len(collection.Todos[0].DependsOn) != 0 {
+		t.Error("Expected the refused dependency not to be added")
+	}
+}
+
+func TestUnblock(t *testing.T) {
+	collection := dependencyCollection()
+	if _, err := collection.Unblock(4, []int64{1}); err == nil {
+		t.Error("Expected removing a missing dependency to fail")
+	}
+	todo, _ := collection.Unblock(4, []int64{2})
+	if joinIDs(todo.DependsOn) != "3" {
+		t.Errorf("Expected the todo to be blocked by 3 only, got %v", todo.DependsOn)
+	}
+	todo, _ = collection.Unblock(4, nil)
+	if todo.DependsOn != nil {
+		t.Errorf("Expected the todo not to be blocked anymore, got %v", todo.DependsOn)
+	}
+}
+
+func TestBlockers(t *testing.T) {
+	collection := dependencyCollection()
+	collection.SetStatus(2, DONE)
+	blockers, err := collection.Blockers()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(blockers) != 1 || joinIDs(blockers[4]) != "3" {
+		t.Errorf("Expected the todo 4 to be blocked by 3 only, got %v", blockers)
+	}
+
+	collection.SetStatus(3, DONE)
+	if blockers, _ = collection.Blockers(); len(blockers) != 0 {
+		t.Errorf("Expected no blocked todo, got %v", blockers)
+	}
+}
+
+func TestListActionableTodos(t *testing.T) {
+	collection := dependencyCollection()
+	collection.SetStatus(1, DONE)
+	if err := collection.ListActionableTodos(); err != nil {
+		t.Fatal(err)
+	}
+	if len(collection.Todos) != 2 || collection.Todos[0].ID != 2 || collection.Todos[1].ID != 3 {
+		t.Errorf("Expected only the todos 2 and 3 to be actionable, got %d todos", len(collection.Todos))
+	}
+}
+
+func TestActionableParent(t *testing.T) {
+	collection := subtaskCollection()
+	if err := collection.ListActionableTodos(); err != nil {
+		t.Fatal(err)
+	}
+	// 1 and 3 wait for their subtasks
+	if len(collection.Todos) != 3 || collection.Todos[0].ID != 2 || collection.Todos[1].ID != 4 || collection.Todos[2].ID != 5 {
+		t.Errorf("Expected only the todos 2, 4 and 5 to be actionable, got %d todos", len(collection.Todos))
+	}
+
+	collection = subtaskCollection()
+	collection.SetStatus(4, DONE)
+	collection.ListActionableTodos()
+	if len(collection.Todos) != 3 || collection.Todos[1].ID != 3 {
+		t.Errorf("Expected the todo 3 to be actionable once its subtask is done, got %d todos", len(collection.Todos))
+	}
+}
+
+func TestBlockersOfSelection(t *testing.T) {
+	store := db.NewSQLiteStore(t.TempDir() + "/" + db.FileName)
+	store.Initialize()
+	full := dependencyCollection()
+	full.store = store
+	full.SetStatus(2, DONE)
+	full.SetStatus(4, WIP)
+	if err := full.WriteTodos(); err != nil {
+		t.Fatal(err)
+	}
+
+	collection := Collection{store: store}
+	if err := collection.retrieve(&db.Filter{Statuses: []string{WIP}}); err != nil {
+		t.Fatal(err)
+	}
+	defer collection.Close()
+	blockers, err := collection.Blockers()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if joinIDs(blockers[4]) != "3" {
+		t.Errorf("Expected the pending todo 3 to block the selection, got %v", blockers[4])
+	}
+}
+
+func TestRenumberingKeepsDependencies(t *testing.T) {
+	collection := dependencyCollection()
+	collection.SetStatus(2, DONE)
+	collection.RemoveFinishedTodos()
+	if depends := dependsOf(t, collection, "Deploy"); joinIDs(depends) != "3" {
+		t.Errorf("Expected the removed todo to be dropped from the dependencies, got %v", depends)
+	}
+	collection.Reorder()
+	if depends := dependsOf(t, collection, "Deploy"); joinIDs(depends) != "2" {
+		t.Errorf("Expected \"Deploy\" to follow \"Review\" renumbered 2, got %v", depends)
+	}
+
+	collection = dependencyCollection()
+	collection.Swap(1, 3)
+	if depends := dependsOf(t, collection, "Deploy"); joinIDs(depends) != "2, 1" {
+		t.Errorf("Expected \"Deploy\" to follow \"Review\" swapped to 1, got %v", depends)
+	}
+
+	collection = dependencyCollection()
+	collection.ReorderByIDs([]int64{4, 3, 2})
+	if depends := dependsOf(t, collection, "Deploy"); joinIDs(depends) != "3, 2" {
+		t.Errorf("Expected \"Deploy\" to follow its dependencies reordered, got %v", depends)
+	}
+}
+
+func ExampleTodo_MakeTreeOutput_blocked() {
+	todo := Todo{ID: 4, Desc: "Deploy", Status: "pending"}
+	todo.MakeTreeOutput(false, 0, Progress{}, []int64{2, 3})
+	// Output: 4 | ✕ Deploy (blocked by 2, 3)
+}
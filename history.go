@@ -0,0 +1,138 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// EnvUser environnement variable name for the author of the changes, $USER
+// when it is not set
+const EnvUser = "TODO_USER"
+
+// Actions of the events of a todo
+const (
+	EventCreated    = "created"
+	EventDesc       = "desc"
+	EventStatus     = "status"
+	EventRenumbered = "id"
+	EventDue        = "due"
+	EventPriority   = "priority"
+	EventDepends    = "depends"
+	EventNote       = "note"
+	EventArchived   = "archived"
+	EventRestored   = "restored"
+)
+
+// Event is a change of a todo
+type Event struct {
+	Date   time.Time `json:"date"`
+	Author string    `json:"author,omitempty"`
+	Action string    `json:"action"`
+	From   string    `json:"from,omitempty"`
+	To     string    `json:"to,omitempty"`
+}
+
+// String describes the event, like "status changed from pending to wip"
+func (e Event) String() string {
+	switch e.Action {
+	case EventCreated, EventArchived, EventRestored:
+		return e.Action
+	case EventRenumbered:
+		return fmt.Sprintf("renumbered from %s to %s", e.From, e.To)
+	case EventNote:
+		return "note added"
+	case EventDesc:
+		return fmt.Sprintf("description changed from %q to %q", e.From, e.To)
+	}
+	return fmt.Sprintf("%s changed from %s to %s", actionNames[e.Action], orNone(e.From), orNone(e.To))
+}
+
+var actionNames = map[string]string{
+	EventStatus:   "status",
+	EventDue:      "due date",
+	EventPriority: "priority",
+	EventDepends:  "dependencies",
+}
+
+func orNone(value string) string {
+	if value == "" {
+		return "none"
+	}
+	return value
+}
+
+// CurrentUser returns the author of the changes: TODO_USER, or the user
+// logged in
+func CurrentUser() string {
+	for _, name := range []string{EnvUser, "USER", "USERNAME"} {
+		if user := os.Getenv(name); user != "" {
+			return user
+		}
+	}
+	return ""
+}
+
+// user returns the author of the changes of the collection
+func (c *Collection) user() string {
+	if c.User != "" {
+		return c.User
+	}
+	return CurrentUser()
+}
+
+// record adds an event to the history of a todo
+func (c *Collection) record(todo *Todo, now time.Time, action string, from string, to string) {
+	todo.History = append(todo.History, Event{Date: now, Author: c.user(), Action: action, From: from, To: to})
+}
+
+// TodoEvent is an event with the todo it changed
+type TodoEvent struct {
+	Todo *Todo
+	Event
+}
+
+// History returns the events of all the todos since a date, from the oldest
+func (c *Collection) History(since time.Time) []TodoEvent {
+	var events []TodoEvent
+	for _, todo := range c.Todos {
+		for _, event := range todo.History {
+			if !event.Date.Before(since) {
+				events = append(events, TodoEvent{todo, event})
+			}
+		}
+	}
+	sort.SliceStable(events, func(i, j int) bool { return events[i].Date.Before(events[j].Date) })
+	return events
+}
+
+// ParseSince reads the start of a period: a duration back from now ("7d",
+// "2w", "1m") or a date accepted by ParseDate
+func ParseSince(value string, now time.Time) (time.Time, error) {
+	value = strings.ToLower(strings.TrimSpace(value))
+	if len(value) > 1 {
+		count, err := strconv.Atoi(value[:len(value)-1])
+		if err == nil && count >= 0 {
+			switch value[len(value)-1] {
+			case 'd':
+				return day(now).AddDate(0, 0, -count), nil
+			case 'w':
+				return day(now).AddDate(0, 0, -7*count), nil
+			case 'm':
+				return addMonths(day(now), -count), nil
+			}
+		}
+	}
+	return ParseDate(value, now)
+}
+
+// dueValue writes a due date in the history
+func dueValue(due time.Time) string {
+	if due.IsZero() {
+		return ""
+	}
+	return due.Format(dateLayout)
+}
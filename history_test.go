@@ -0,0 +1,151 @@
+package main
+
+import (
+	"os"
+	"testing"
+	"time"
+)
+
+func actions(todo *Todo) []string {
+	var names []string
+	for _, event := range todo.History {
+		names = append(names, event.String())
+	}
+	return names
+}
+
+func TestHistory(t *testing.T) {
+	collection := Collection{Now: fixedClock(), User: "tolva"}
+	collection.CreateTodo(NewTodo())
+	task := NewTodo()
+	task.Desc = "call mum"
+	collection.CreateTodo(task)
+
+	collection.SetStatus(2, WIP)
+	collection.SetStatus(2, WIP)
+	collection.Modify(2, "call dad")
+	collection.SetDue(2, time.Date(2018, 6, 1, 15, 0, 0, 0, time.UTC))
+	collection.SetPriority(2, "A")
+	collection.SetPriority(2, "A")
+	collection.Block(2, []int64{1})
+	collection.AddNote(2, "after lunch")
+	collection.Unblock(2, nil)
+
+	expected := []string{
+		"created",
+		"status changed from pending to wip",
+		`description changed from "call mum" to "call dad"`,
+		"due date changed from none to 2018-06-01",
+		"priority changed from none to A",
+		"dependencies changed from none to 1",
+		"note added",
+		"dependencies changed from 1 to none",
+	}
+	got := actions(task)
+	if len(got) != len(expected) {
+		t.Fatalf("Expected %d events, got %q", len(expected), got)
+	}
+	for i := range expected {
+		if got[i] != expected[i] {
+			t.Errorf("Expected the event %d to be %q, got %q", i, expected[i], got[i])
+		}
+	}
+	for _, event := range task.History {
+		if event.Author != "tolva" || event.Date.IsZero() {
+			t.Errorf("Expected the event to be dated and attributed, got %+v", event)
+		}
+	}
+	if !task.History[len(task.History)-1].Date.Equal(task.Modified) {
+		t.Error("Expected the last event at the last modification of the todo")
+	}
+}
+
+func TestHistorySurvivesRenumbering(t *testing.T) {
+	collection, _ := collectionFromTaskDesk([]string{"Write", "Test", "Deploy"})
+	collection.User = "tolva"
+	collection.RemoveAtIndex(0)
+	collection.Reorder()
+
+	for _, todo := range collection.Todos {
+		if len(todo.History) != 1 || todo.History[0].Action != EventRenumbered {
+			t.Fatalf("Expected the todo %d to keep a trace of its renumbering, got %q", todo.ID, actions(todo))
+		}
+	}
+	if event := collection.Todos[1].History[0]; event.String() != "renumbered from 3 to 2" {
+		t.Errorf("Expected \"Deploy\" to be renumbered from 3 to 2, got %q", event)
+	}
+
+	collection.Swap(1, 2)
+	if history := actions(collection.Todos[0]); len(history) != 2 || history[1] != "renumbered from 2 to 1" {
+		t.Errorf("Expected the swap to be recorded, got %q", history)
+	}
+
+	collection.RemoveFinishedTodos()
+	if history := actions(collection.Todos[0]); len(history) != 2 {
+		t.Errorf("Expected no renumbering when the IDs are kept, got %q", history)
+	}
+}
+
+func TestHistorySince(t *testing.T) {
+	collection := Collection{Now: fixedClock()}
+	collection.CreateTodo(NewTodo())
+	collection.CreateTodo(NewTodo())
+	collection.SetStatus(1, DONE)
+
+	events := collection.History(time.Time{})
+	if len(events) != 3 {
+		t.Fatalf("Expected 3 events, got %d", len(events))
+	}
+	if events[0].Todo.ID != 1 || events[1].Todo.ID != 2 || events[2].Todo.ID != 1 {
+		t.Error("Expected the events of all the todos from the oldest")
+	}
+
+	since := time.Date(2018, 5, 25, 12, 0, 0, 0, time.UTC)
+	if events = collection.History(since); len(events) != 2 || events[0].Action != EventCreated {
+		t.Errorf("Expected the events since noon, got %d", len(events))
+	}
+}
+
+func TestParseSince(t *testing.T) {
+	now := time.Date(2018, 5, 25, 15, 30, 0, 0, time.UTC)
+	cases := map[string]string{
+		"7d":         "2018-05-18",
+		"2w":         "2018-05-11",
+		"1m":         "2018-04-25",
+		"0d":         "2018-05-25",
+		"yesterday":  "2018-05-24",
+		"2018-01-31": "2018-01-31",
+	}
+	for value, expected := range cases {
+		since, err := ParseSince(value, now)
+		if err != nil {
+			t.Error(err)
+			continue
+		}
+		if since.Format(dateLayout) != expected || since.Hour() != 0 {
+			t.Errorf("Expected \"%s\" to start on %s, got %s", value, expected, since)
+		}
+	}
+	if _, err := ParseSince("lately", now); err == nil {
+		t.Error("Expected an unknown period to be refused")
+	}
+}
+
+func TestCurrentUser(t *testing.T) {
+	for _, name := range []string{EnvUser, "USER", "USERNAME"} {
+		defer os.Setenv(name, os.Getenv(name))
+		os.Unsetenv(name)
+	}
+
+	if user := CurrentUser(); user != "" {
+		t.Errorf("Expected no user, got \"%s\"", user)
+	}
+	os.Setenv("USER", "gael")
+	if user := CurrentUser(); user != "gael" {
+		t.Errorf("Expected the logged in user, got \"%s\"", user)
+	}
+	os.Setenv(EnvUser, "tolva")
+	if user := CurrentUser(); user != "tolva" {
+		t.Errorf("Expected %s to take precedence, got \"%s\"", EnvUser, user)
+	}
+}
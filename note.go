@@ -0,0 +1,119 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/daviddengcn/go-colortext"
+)
+
+// Note is an annotation added to a todo, kept in the order they were added
+type Note struct {
+	Created time.Time `json:"created"`
+	Text    string    `json:"text"`
+}
+
+// AddNote append a note to a todo
+func (c *Collection) AddNote(id int64, text string) (*Todo, error) {
+	todo, err := c.Find(id)
+	if err != nil {
+		return todo, err
+	}
+
+	text = strings.TrimSpace(text)
+	if text == "" {
+		return todo, errors.New("The note is empty.")
+	}
+
+	now := c.now()
+	todo.Notes = append(todo.Notes, Note{Created: now, Text: text})
+	c.record(todo, now, EventNote, "", "")
+	todo.Modified = now
+
+	return todo, err
+}
+
+// SearchNotes retains only the todos whose description or one of the notes
+// matches a sentence
+func (c *Collection) SearchNotes(sentence string) {
+	re := regexp.MustCompile("(?i)" + regexp.QuoteMeta(sentence))
+	for i := len(c.Todos) - 1; i >= 0; i-- {
+		if !re.MatchString(c.Todos[i].Desc) && !c.Todos[i].notesMatch(re) {
+			c.RemoveAtIndex(i)
+		}
+	}
+}
+
+func (t *Todo) notesMatch(re *regexp.Regexp) bool {
+	for _, note := range t.Notes {
+		if re.MatchString(note.Text) {
+			return true
+		}
+	}
+	return false
+}
+
+// timeLayout is the layout of the timestamps printed by td show
+const timeLayout = "2006-01-02 15:04"
+
+// MakeDetailedOutput print todo followed by all its metadata and notes
+func (t *Todo) MakeDetailedOutput(useColor bool, blockers []int64) {
+	t.MakeOutput(useColor)
+	fmt.Println()
+
+	printField("UID", t.UID)
+	printField("Status", t.Status)
+	printTime("Created", t.Created)
+	printTime("Modified", t.Modified)
+	printTime("Started", t.Started)
+	printTime("Completed", t.Completed)
+	if !t.Due.IsZero() {
+		printField("Due", t.Due.Format(dateLayout))
+	}
+	printField("Priority", t.Priority)
+	printField("Tags", strings.Join(t.Tags, ", "))
+	printField("Project", t.Project)
+	if t.Parent != 0 {
+		printField("Parent", fmt.Sprint(t.Parent))
+	}
+	if len(t.DependsOn) > 0 {
+		printField("Depends on", joinIDs(t.DependsOn))
+	}
+	if len(blockers) > 0 {
+		printField("Blocked by", joinIDs(blockers))
+	}
+	if t.Recur != nil {
+		printField("Recurrence", t.Recur.String())
+	}
+
+	for _, note := range t.Notes {
+		fmt.Println()
+		if useColor {
+			ct.ChangeColor(ct.Cyan, false, ct.None, false)
+		}
+		fmt.Print("  ", note.Created.Local().Format(timeLayout))
+		if useColor {
+			ct.ResetColor()
+		}
+		fmt.Println()
+		for _, line := range strings.Split(note.Text, "\n") {
+			fmt.Println("    " + line)
+		}
+	}
+}
+
+// printField print a metadata of a todo, unless it is empty
+func printField(name string, value string) {
+	if value != "" {
+		fmt.Printf("  %-11s %s\n", name+":", value)
+	}
+}
+
+func printTime(name string, value time.Time) {
+	if !value.IsZero() {
+		printField(name, value.Local().Format(timeLayout))
+	}
+}
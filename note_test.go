@@ -0,0 +1,80 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestAddNote(t *testing.T) {
+	collection, _ := collectionFromTaskDesk([]string{"Fix the sink"})
+	collection.Now = fixedClock()
+
+	if _, err := collection.AddNote(1, "  \n "); err == nil {
+		t.Error("Expected an empty note to be refused")
+	}
+	if _, err := collection.AddNote(2, "call the plumber"); err == nil {
+		t.Error("Expected a note on a missing todo to fail")
+	}
+
+	collection.AddNote(1, "call the plumber\n")
+	todo, err := collection.AddNote(1, "he comes\non monday")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(todo.Notes) != 2 || todo.Notes[0].Text != "call the plumber" || todo.Notes[1].Text != "he comes\non monday" {
+		t.Errorf("Expected the notes to be appended in order, got %+v", todo.Notes)
+	}
+	created := time.Date(2018, 5, 25, 11, 0, 0, 0, time.UTC)
+	if !todo.Notes[0].Created.Equal(created) || !todo.Notes[1].Created.After(created) {
+		t.Errorf("Expected the notes to be dated, got %+v", todo.Notes)
+	}
+	if !todo.Modified.Equal(todo.Notes[1].Created) {
+		t.Errorf("Expected the todo to be modified with its last note, got %s", todo.Modified)
+	}
+}
+
+func TestSearchNotes(t *testing.T) {
+	collection, _ := collectionFromTaskDesk([]string{"Fix the sink", "Call the Plumber", "Buy milk"})
+	collection.AddNote(1, "ask the plumber")
+
+	collection.Search("plumber")
+	if len(collection.Todos) != 1 {
+		t.Errorf("Expected the notes to be ignored by Search, got %d todos", len(collection.Todos))
+	}
+
+	collection, _ = collectionFromTaskDesk([]string{"Fix the sink", "Call the Plumber", "Buy milk"})
+	collection.AddNote(1, "ask the plumber")
+	collection.SearchNotes("plumber")
+	if len(collection.Todos) != 2 || collection.Todos[0].ID != 1 || collection.Todos[1].ID != 2 {
+		t.Errorf("Expected the todos 1 and 2 to match, got %d todos", len(collection.Todos))
+	}
+}
+
+func ExampleTodo_MakeOutput_notes() {
+	todo := Todo{ID: 1, Desc: "Fix the sink", Status: "pending", Notes: []Note{{Text: "call the plumber"}}}
+	todo.MakeOutput(false)
+	// Output: 1 | ✕ Fix the sink ✎1
+}
+
+func ExampleTodo_MakeDetailedOutput() {
+	todo := Todo{
+		ID:        4,
+		Desc:      "Deploy +api",
+		Status:    "wip",
+		Project:   "api",
+		DependsOn: []int64{2, 3},
+		Notes:     []Note{{Created: time.Date(2018, 5, 25, 10, 0, 0, 0, time.Local), Text: "staging first\nthen production"}},
+	}
+	todo.MakeDetailedOutput(false, []int64{3})
+	// Output:
+	// 4 | • Deploy +api ✎1
+	//
+	//   Status:     wip
+	//   Project:    api
+	//   Depends on: 2, 3
+	//   Blocked by: 3
+	//
+	//   2018-05-25 10:00
+	//     staging first
+	//     then production
+}
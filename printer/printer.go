@@ -9,4 +9,8 @@ const (
 	KoSign = "✕"
 	// WpSign symbol for wip
 	WpSign = "•"
+	// NoteSign symbol for the todos having notes
+	NoteSign = "✎"
+	// UnknownSign symbol for a status which is not configured
+	UnknownSign = "?"
 )
@@ -3,7 +3,9 @@
 package printer
 
 const (
-	OkSign = "V"
-	KoSign = "X"
-	WpSign = "W"
+	OkSign      = "V"
+	KoSign      = "X"
+	WpSign      = "W"
+	NoteSign    = "*"
+	UnknownSign = "?"
 )
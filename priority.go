@@ -0,0 +1,57 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Priorities from the highest to the lowest. A todo without priority comes
+// after all of them.
+const priorities = "ABCDE"
+
+var priorityAliases = map[string]string{
+	"high":   "A",
+	"medium": "C",
+	"low":    "E",
+	"none":   "",
+}
+
+// ParsePriority reads a priority level: a letter from A to E, high, medium,
+// low or none
+func ParsePriority(level string) (string, error) {
+	level = strings.ToLower(strings.TrimSpace(level))
+	if priority, ok := priorityAliases[level]; ok {
+		return priority, nil
+	}
+	if len(level) == 1 && strings.Contains(priorities, strings.ToUpper(level)) {
+		return strings.ToUpper(level), nil
+	}
+	return "", fmt.Errorf("\"%s\" is not a priority: use a letter from A to E, high, medium, low or none", level)
+}
+
+// BumpPriority raises (up) or lowers a priority by one level. A todo without
+// priority is raised to the lowest one, and lowering the lowest one removes it.
+func BumpPriority(priority string, up bool) string {
+	rank := priorityRank(priority)
+	if up {
+		rank--
+	} else {
+		rank++
+	}
+	switch {
+	case rank < 0:
+		rank = 0
+	case rank >= len(priorities):
+		return ""
+	}
+	return priorities[rank : rank+1]
+}
+
+// priorityRank returns the position of a priority, len(priorities) for none
+// and for an unknown one, found in a file edited by hand
+func priorityRank(priority string) int {
+	if rank := strings.Index(priorities, priority); priority != "" && rank >= 0 {
+		return rank
+	}
+	return len(priorities)
+}
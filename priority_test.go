@@ -0,0 +1,64 @@
+package main
+
+import "testing"
+
+func TestParsePriority(t *testing.T) {
+	cases := map[string]string{
+		"A":      "A",
+		"c":      "C",
+		"high":   "A",
+		"Medium": "C",
+		"low":    "E",
+		"none":   "",
+	}
+	for level, expected := range cases {
+		priority, err := ParsePriority(level)
+		if err != nil || priority != expected {
+			t.Errorf("Expected \"%s\" to be the priority \"%s\", got \"%s\" (%v)", level, expected, priority, err)
+		}
+	}
+	for _, level := range []string{"F", "urgent", "AB", ""} {
+		if _, err := ParsePriority(level); err == nil {
+			t.Errorf("Expected \"%s\" not to be a priority", level)
+		}
+	}
+}
+
+func TestBumpPriority(t *testing.T) {
+	cases := []struct {
+		priority string
+		up       bool
+		expected string
+	}{
+		{"C", true, "B"},
+		{"A", true, "A"},
+		{"", true, "E"},
+		{"C", false, "D"},
+		{"E", false, ""},
+		{"", false, ""},
+	}
+	for _, c := range cases {
+		if bumped := BumpPriority(c.priority, c.up); bumped != c.expected {
+			t.Errorf("Expected \"%s\" bumped (up: %t) to be \"%s\", got \"%s\"", c.priority, c.up, c.expected, bumped)
+		}
+	}
+}
+
+func TestUnknownPriority(t *testing.T) {
+	if priorityRank("Z") != priorityRank("") {
+		t.Errorf("Expected an unknown priority to rank as no priority, got %d", priorityRank("Z"))
+	}
+
+	collection, _ := collectionFromTaskDesk([]string{"unknown", "high", "none"})
+	collection.Todos[0].Priority = "Z"
+	collection.Todos[1].Priority = "A"
+	collection.Sort("priority")
+	if collection.Todos[0].Desc != "high" || collection.Todos[1].Desc != "unknown" {
+		t.Errorf("Expected an unknown priority to come after A, got %s first", collection.Todos[0].Desc)
+	}
+
+	q, _ := ParseQuery("priority>a", queryNow)
+	if err := collection.Query(q, false); err != nil || len(collection.Todos) != 0 {
+		t.Errorf("Expected no priority higher than A, got %d todos", len(collection.Todos))
+	}
+}
@@ -0,0 +1,101 @@
+package main
+
+import (
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// projectReg matches the +project tokens of a description, todo.txt style:
+// + at the start of a word followed by letters, digits, _, - or /
+var projectReg = regexp.MustCompile(`(?:^|\s)(\+[\p{L}\p{N}_](?:[\p{L}\p{N}_\-/]*[\p{L}\p{N}_])?)`)
+
+// ProjectCount is the number of todos of a project by status
+type ProjectCount struct {
+	Pending int
+	// Started are the todos in any status between the initial and the
+	// finished ones, like wip or review with TODO_STATUSES
+	Started int
+	Done    int
+}
+
+// ParseProject returns the project of a description: its first +project
+// token, in lower case without the leading +
+func ParseProject(desc string) string {
+	match := projectReg.FindStringSubmatch(desc)
+	if match == nil {
+		return ""
+	}
+	return NormalizeProject(match[1])
+}
+
+// NormalizeProject returns a project as stored in a todo: in lower case, without +
+func NormalizeProject(project string) string {
+	return strings.ToLower(strings.TrimPrefix(strings.TrimSpace(project), "+"))
+}
+
+// projectIndexes returns the positions of the +project tokens of a description
+func projectIndexes(desc string) [][]int {
+	var indexes [][]int
+	for _, match := range projectReg.FindAllStringSubmatchIndex(desc, -1) {
+		indexes = append(indexes, match[2:4])
+	}
+	return indexes
+}
+
+// syncProject parses the project of the description
+func (t *Todo) syncProject() {
+	t.Project = ParseProject(t.Desc)
+}
+
+// ListProject keep only the todos of a project
+func (c *Collection) ListProject(project string) {
+	project = NormalizeProject(project)
+	for i := len(c.Todos) - 1; i >= 0; i-- {
+		if c.Todos[i].Project != project {
+			c.RemoveAtIndex(i)
+		}
+	}
+}
+
+// Projects returns the number of todos by status for each project. The todos
+// without project are counted under the empty name.
+func (c *Collection) Projects() map[string]*ProjectCount {
+	counts := map[string]*ProjectCount{}
+	for _, todo := range c.Todos {
+		count, ok := counts[todo.Project]
+		if !ok {
+			count = new(ProjectCount)
+			counts[todo.Project] = count
+		}
+		switch {
+		case todo.IsFinished():
+			count.Done++
+		case todo.Status == initialStatus() || !isStatus(todo.Status):
+			count.Pending++
+		default:
+			count.Started++
+		}
+	}
+	return counts
+}
+
+// GroupByProject returns the project names in alphabetical order, the todos
+// without project last, and the todos of each project in their current order
+func (c *Collection) GroupByProject() ([]string, map[string][]*Todo) {
+	groups := map[string][]*Todo{}
+	var names []string
+	for _, todo := range c.Todos {
+		if _, ok := groups[todo.Project]; !ok {
+			names = append(names, todo.Project)
+		}
+		groups[todo.Project] = append(groups[todo.Project], todo)
+	}
+	sort.Slice(names, func(i, j int) bool {
+		if names[i] == "" || names[j] == "" {
+			return names[j] == ""
+		}
+		return names[i] < names[j]
+	})
+	return names, groups
+}
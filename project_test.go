@@ -0,0 +1,62 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseProject(t *testing.T) {
+	cases := map[string]string{
+		"call mum":                      "",
+		"+API fix the login":            "api",
+		"fix the login +api +web":       "api",
+		"1+1 is not a project, C++ too": "",
+		"deploy +front-end/v2.":         "front-end/v2",
+	}
+	for desc, expected := range cases {
+		if project := ParseProject(desc); project != expected {
+			t.Errorf("Expected the project of \"%s\" to be \"%s\", got \"%s\"", desc, expected, project)
+		}
+	}
+}
+
+func TestProjects(t *testing.T) {
+	collection, _ := collectionFromTaskDesk([]string{"Fix +api", "Call mum", "Deploy +web", "Test +api"})
+	for _, todo := range collection.Todos {
+		todo.syncProject()
+	}
+	collection.SetStatus(1, DONE)
+	collection.SetStatus(4, WIP)
+
+	counts := collection.Projects()
+	if !reflect.DeepEqual(*counts["api"], ProjectCount{Started: 1, Done: 1}) {
+		t.Errorf("Expected 1 started and 1 done todo in +api, got %+v", *counts["api"])
+	}
+	if counts[""].Pending != 1 {
+		t.Errorf("Expected 1 todo without project, got %+v", *counts[""])
+	}
+
+	names, groups := collection.GroupByProject()
+	if !reflect.DeepEqual(names, []string{"api", "web", ""}) {
+		t.Errorf("Expected the projects api, web and none, got %q", names)
+	}
+	if len(groups["api"]) != 2 || groups["api"][1].ID != 4 {
+		t.Errorf("Expected the todos 1 and 4 in +api, got %d todos", len(groups["api"]))
+	}
+
+	collection.ListProject("+API")
+	if len(collection.Todos) != 2 {
+		t.Errorf("Expected 2 todos in +api, got %d", len(collection.Todos))
+	}
+}
+
+func TestProjectFollowsDescription(t *testing.T) {
+	var collection Collection
+	task := NewTodo()
+	task.Desc = "Fix +api"
+	collection.CreateTodo(task)
+	collection.Modify(task.ID, "Fix +web")
+	if task.Project != "web" {
+		t.Errorf("Expected the project to follow the description, got \"%s\"", task.Project)
+	}
+}
@@ -0,0 +1,718 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+)
+
+// Query selects todos, like `status:wip tag:api due<2018-07-01 "login bug"
+// -tag:later`. The terms are combined with AND, implied between two terms,
+// OR and NOT or -, and grouped with parentheses. See ParseQuery.
+type Query interface {
+	match(t *Todo, env *queryEnv) bool
+	// String writes the query in prefix notation, like (and status:wip "bug")
+	String() string
+}
+
+// queryEnv is what a query needs besides the todo
+type queryEnv struct {
+	now      time.Time
+	blockers map[int64][]int64
+	// notes is set when the text terms match the notes of the todos too
+	notes bool
+}
+
+type allQuery struct{}
+
+type andQuery []Query
+
+type orQuery []Query
+
+type notQuery struct {
+	Query
+}
+
+// textQuery matches the todos containing a text, whatever its case
+type textQuery string
+
+// fieldQuery compares a field of the todos to a value, like due<2018-07-01
+type fieldQuery struct {
+	field string
+	op    string
+	value string
+	// date, number and priority are the value parsed for the fields needing it
+	date     time.Time
+	number   int64
+	priority int
+}
+
+// QueryError is an error of a query, at a column counted in characters from 1
+type QueryError struct {
+	Query   string
+	Column  int
+	Message string
+}
+
+func (e *QueryError) Error() string {
+	return fmt.Sprintf("Invalid query at column %d: %s.", e.Column, e.Message)
+}
+
+// Detail returns the error followed by the query and a caret under the
+// column of the error
+func (e *QueryError) Detail() string {
+	return fmt.Sprintf("%s\n  %s\n  %s^", e.Error(), e.Query, strings.Repeat(" ", e.Column-1))
+}
+
+// The fields of a query, with the operators they accept
+var queryFields = map[string]string{
+	"text":      ":",
+	"note":      ":",
+	"status":    ":=",
+	"tag":       ":=",
+	"project":   ":=",
+	"uid":       ":=",
+	"is":        ":=",
+	"priority":  ":=<>",
+	"due":       ":=<>",
+	"created":   ":=<>",
+	"modified":  ":=<>",
+	"completed": ":=<>",
+	"id":        ":=<>",
+}
+
+// queryStates are the values of is:
+var queryStates = []string{"overdue", "today", "finished", "recurring", "blocked", "subtask"}
+
+type tokenKind int
+
+const (
+	tokenEnd tokenKind = iota
+	tokenWord
+	tokenText
+	tokenField
+	tokenOpen
+	tokenClose
+	tokenAnd
+	tokenOr
+	tokenNot
+)
+
+type token struct {
+	kind   tokenKind
+	column int
+	// text is the word or the quoted text, or the value of a field
+	text  string
+	field string
+	op    string
+	// valueColumn is the column of the value of a field
+	valueColumn int
+}
+
+var fieldReg = regexp.MustCompile(`^([a-zA-Z]+)(<=|>=|:|=|<|>)`)
+
+// lexQuery splits a query in tokens
+func lexQuery(query string) ([]token, error) {
+	runes := []rune(query)
+	var tokens []token
+	fail := func(column int, format string, a ...interface{}) ([]token, error) {
+		return nil, &QueryError{Query: query, Column: column, Message: fmt.Sprintf(format, a...)}
+	}
+	// quoted reads the text quoted at i, returning the position after it
+	quoted := func(i int) (string, int, bool) {
+		var text strings.Builder
+		for j := i + 1; j < len(runes); j++ {
+			switch {
+			case runes[j] == '\\' && j+1 < len(runes) && (runes[j+1] == '"' || runes[j+1] == '\\'):
+				j++
+				text.WriteRune(runes[j])
+			case runes[j] == '"':
+				return text.String(), j + 1, true
+			default:
+				text.WriteRune(runes[j])
+			}
+		}
+		return "", 0, false
+	}
+	isDelimiter := func(r rune) bool {
+		return unicode.IsSpace(r) || r == '(' || r == ')' || r == '"'
+	}
+
+	for i := 0; i < len(runes); {
+		r := runes[i]
+		column := i + 1
+		switch {
+		case unicode.IsSpace(r):
+			i++
+		case r == '(':
+			tokens = append(tokens, token{kind: tokenOpen, column: column})
+			i++
+		case r == ')':
+			tokens = append(tokens, token{kind: tokenClose, column: column})
+			i++
+		case r == '"':
+			text, next, ok := quoted(i)
+			if !ok {
+				return fail(column, "the quote opened here is never closed")
+			}
+			tokens = append(tokens, token{kind: tokenText, column: column, text: text})
+			i = next
+		case r == '-' && i+1 < len(runes) && !unicode.IsSpace(runes[i+1]) && runes[i+1] != '-' && runes[i+1] != ')':
+			tokens = append(tokens, token{kind: tokenNot, column: column, text: "-"})
+			i++
+		default:
+			j := i
+			for j < len(runes) && !isDelimiter(runes[j]) {
+				j++
+			}
+			word := string(runes[i:j])
+			switch word {
+			case "AND":
+				tokens = append(tokens, token{kind: tokenAnd, column: column, text: word})
+				i = j
+				continue
+			case "OR":
+				tokens = append(tokens, token{kind: tokenOr, column: column, text: word})
+				i = j
+				continue
+			case "NOT":
+				tokens = append(tokens, token{kind: tokenNot, column: column, text: word})
+				i = j
+				continue
+			}
+
+			match := fieldReg.FindStringSubmatch(word)
+			if match == nil {
+				tokens = append(tokens, token{kind: tokenWord, column: column, text: word})
+				i = j
+				continue
+			}
+			field := token{kind: tokenField, column: column, field: strings.ToLower(match[1]), op: match[2]}
+			field.valueColumn = column + len([]rune(match[0]))
+			field.text = string(runes[i+len([]rune(match[0])) : j])
+			if field.text == "" && j < len(runes) && runes[j] == '"' {
+				text, next, ok := quoted(j)
+				if !ok {
+					return fail(j+1, "the quote opened here is never closed")
+				}
+				field.text = text
+				field.valueColumn = j + 2
+				j = next
+			}
+			tokens = append(tokens, field)
+			i = j
+		}
+	}
+	return append(tokens, token{kind: tokenEnd, column: len(runes) + 1}), nil
+}
+
+type queryParser struct {
+	query  string
+	tokens []token
+	pos    int
+	now    time.Time
+}
+
+// ParseQuery reads a query. Its terms are:
+//
+//   - a word or a "quoted text", contained in the description
+//   - text:, note: a text contained in the description, in a note
+//   - status:, tag:, project:, the todos having this status, tag or project
+//   - uid: the todos whose UID starts with the value
+//   - priority, due, created, modified, completed and id, compared with :,
+//     =, <, <=, > or >= to a priority (A is greater than B), a date accepted
+//     by ParseDate or a number; priority:none and due:none select the todos
+//     without them
+//   - is:overdue, is:today, is:finished, is:recurring, is:blocked, is:subtask
+//
+// A term preceded by - or NOT is negated. Two terms are both required,
+// unless OR separates them; AND binds tighter than OR. An empty query selects
+// all the todos.
+func ParseQuery(query string, now time.Time) (Query, error) {
+	tokens, err := lexQuery(query)
+	if err != nil {
+		return nil, err
+	}
+	p := &queryParser{query: query, tokens: tokens, now: now}
+	if p.peek().kind == tokenEnd {
+		return allQuery{}, nil
+	}
+
+	q, err := p.parseOr()
+	if err != nil {
+		return nil, err
+	}
+	switch t := p.peek(); t.kind {
+	case tokenEnd:
+		return q, nil
+	case tokenClose:
+		return nil, p.fail(t.column, "this parenthesis closes nothing")
+	default:
+		return nil, p.fail(t.column, "unexpected %s", describe(t))
+	}
+}
+
+func (p *queryParser) peek() token {
+	return p.tokens[p.pos]
+}
+
+func (p *queryParser) next() token {
+	t := p.tokens[p.pos]
+	if t.kind != tokenEnd {
+		p.pos++
+	}
+	return t
+}
+
+func (p *queryParser) fail(column int, format string, a ...interface{}) error {
+	return &QueryError{Query: p.query, Column: column, Message: fmt.Sprintf(format, a...)}
+}
+
+// startsTerm tells if a token can start a term
+func startsTerm(t token) bool {
+	switch t.kind {
+	case tokenWord, tokenText, tokenField, tokenOpen, tokenNot:
+		return true
+	}
+	return false
+}
+
+// describe names a token in the errors
+func describe(t token) string {
+	switch t.kind {
+	case tokenEnd:
+		return "end of the query"
+	case tokenOpen:
+		return "\"(\""
+	case tokenClose:
+		return "\")\""
+	}
+	return fmt.Sprintf("\"%s\"", t.text)
+}
+
+// expectTerm checks a term follows an operator
+func (p *queryParser) expectTerm(operator token) error {
+	if t := p.peek(); !startsTerm(t) {
+		return p.fail(t.column, "%s must be followed by a term, not by the %s", operator.text, describe(t))
+	}
+	return nil
+}
+
+func (p *queryParser) parseOr() (Query, error) {
+	var terms orQuery
+	for {
+		q, err := p.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		terms = append(terms, q)
+		if p.peek().kind != tokenOr {
+			break
+		}
+		if err := p.expectTerm(p.next()); err != nil {
+			return nil, err
+		}
+	}
+	if len(terms) == 1 {
+		return terms[0], nil
+	}
+	return terms, nil
+}
+
+func (p *queryParser) parseAnd() (Query, error) {
+	var terms andQuery
+	for {
+		t := p.peek()
+		if t.kind == tokenAnd || t.kind == tokenOr {
+			if len(terms) == 0 {
+				return nil, p.fail(t.column, "%s must follow a term", t.text)
+			}
+			if t.kind == tokenOr {
+				break
+			}
+			if err := p.expectTerm(p.next()); err != nil {
+				return nil, err
+			}
+			continue
+		}
+		if !startsTerm(t) {
+			if len(terms) == 0 {
+				return nil, p.fail(t.column, "a term is expected, not the %s", describe(t))
+			}
+			break
+		}
+		q, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		terms = append(terms, q)
+	}
+	if len(terms) == 1 {
+		return terms[0], nil
+	}
+	return terms, nil
+}
+
+func (p *queryParser) parseUnary() (Query, error) {
+	if p.peek().kind != tokenNot {
+		return p.parsePrimary()
+	}
+	if err := p.expectTerm(p.next()); err != nil {
+		return nil, err
+	}
+	q, err := p.parseUnary()
+	if err != nil {
+		return nil, err
+	}
+	return notQuery{q}, nil
+}
+
+func (p *queryParser) parsePrimary() (Query, error) {
+	t := p.next()
+	switch t.kind {
+	case tokenWord, tokenText:
+		return textQuery(strings.ToLower(t.text)), nil
+	case tokenField:
+		return p.parseField(t)
+	}
+
+	// an opening parenthesis
+	if p.peek().kind == tokenClose {
+		return nil, p.fail(p.peek().column, "the parentheses are empty")
+	}
+	q, err := p.parseOr()
+	if err != nil {
+		return nil, err
+	}
+	if p.peek().kind != tokenClose {
+		return nil, p.fail(t.column, "the parenthesis opened here is never closed")
+	}
+	p.next()
+	return q, nil
+}
+
+func (p *queryParser) parseField(t token) (Query, error) {
+	ops, ok := queryFields[t.field]
+	if !ok {
+		return nil, p.fail(t.column, "%s is not a field, quote \"%s%s%s\" to search it", t.field, t.field, t.op, t.text)
+	}
+	if !strings.Contains(ops, t.op[:1]) {
+		return nil, p.fail(t.valueColumn-len(t.op), "%s can't be compared with %s, use %s:", t.field, t.op, t.field)
+	}
+	if t.text == "" {
+		return nil, p.fail(t.valueColumn, "%s%s needs a value", t.field, t.op)
+	}
+
+	q := fieldQuery{field: t.field, op: t.op, value: strings.ToLower(t.text)}
+	if q.op == "=" {
+		q.op = ":"
+	}
+	switch q.field {
+	case "tag":
+		q.value = NormalizeTag(q.value)
+	case "project":
+		q.value = NormalizeProject(q.value)
+	case "is":
+		valid := false
+		for _, state := range queryStates {
+			valid = valid || state == q.value
+		}
+		if !valid {
+			return nil, p.fail(t.valueColumn, "is:%s is unknown, use is:%s", q.value, strings.Join(queryStates, ", is:"))
+		}
+	case "id":
+		number, err := strconv.ParseInt(q.value, 10, 64)
+		if err != nil {
+			return nil, p.fail(t.valueColumn, "\"%s\" is not an id", t.text)
+		}
+		q.number = number
+	case "priority":
+		if q.value == "none" && q.op == ":" {
+			q.priority = priorityRank("")
+			break
+		}
+		priority, err := ParsePriority(q.value)
+		if err != nil || priority == "" {
+			return nil, p.fail(t.valueColumn, "\"%s\" is not a priority, use A to E, high, medium or low", t.text)
+		}
+		q.priority = priorityRank(priority)
+	case "due", "created", "modified", "completed":
+		if q.value == "none" && q.op == ":" {
+			break
+		}
+		date, err := ParseDate(q.value, p.now)
+		if err != nil {
+			return nil, p.fail(t.valueColumn, "\"%s\" is not a date, use YYYY-MM-DD, today, tomorrow, a weekday, +3d, eow...", t.text)
+		}
+		q.date = date
+	}
+	return q, nil
+}
+
+func (q allQuery) match(t *Todo, env *queryEnv) bool {
+	return true
+}
+
+func (q allQuery) String() string {
+	return "(all)"
+}
+
+func (q andQuery) match(t *Todo, env *queryEnv) bool {
+	for _, term := range q {
+		if !term.match(t, env) {
+			return false
+		}
+	}
+	return true
+}
+
+func (q andQuery) String() string {
+	return listString("and", q)
+}
+
+func (q orQuery) match(t *Todo, env *queryEnv) bool {
+	for _, term := range q {
+		if term.match(t, env) {
+			return true
+		}
+	}
+	return false
+}
+
+func (q orQuery) String() string {
+	return listString("or", q)
+}
+
+func listString(operator string, terms []Query) string {
+	parts := []string{operator}
+	for _, term := range terms {
+		parts = append(parts, term.String())
+	}
+	return "(" + strings.Join(parts, " ") + ")"
+}
+
+func (q notQuery) match(t *Todo, env *queryEnv) bool {
+	return !q.Query.match(t, env)
+}
+
+func (q notQuery) String() string {
+	return "(not " + q.Query.String() + ")"
+}
+
+func (q textQuery) match(t *Todo, env *queryEnv) bool {
+	if strings.Contains(strings.ToLower(t.Desc), string(q)) {
+		return true
+	}
+	return env.notes && t.notesContain(string(q))
+}
+
+func (q textQuery) String() string {
+	return strconv.Quote(string(q))
+}
+
+func (q fieldQuery) match(t *Todo, env *queryEnv) bool {
+	switch q.field {
+	case "text":
+		return strings.Contains(strings.ToLower(t.Desc), q.value)
+	case "note":
+		return t.notesContain(q.value)
+	case "status":
+		return t.Status == q.value
+	case "tag":
+		return t.HasTag(q.value)
+	case "project":
+		return t.Project == q.value
+	case "uid":
+		return strings.HasPrefix(t.UID, q.value)
+	case "is":
+		return t.is(q.value, env)
+	case "id":
+		return compare(q.op, t.ID-q.number)
+	case "priority":
+		// A is the greatest priority, and has the lowest rank
+		return compare(q.op, int64(q.priority-priorityRank(t.Priority)))
+	}
+
+	var date time.Time
+	switch q.field {
+	case "due":
+		date = t.Due
+	case "created":
+		date = t.Created
+	case "modified":
+		date = t.Modified
+	case "completed":
+		date = t.Completed
+	}
+	if q.date.IsZero() {
+		return date.IsZero()
+	}
+	return !date.IsZero() && compare(q.op, int64(daysBetween(q.date, date.Local())))
+}
+
+func (q fieldQuery) String() string {
+	value := q.value
+	if strings.ContainsAny(value, " \"()") {
+		value = strconv.Quote(value)
+	}
+	return q.field + q.op + value
+}
+
+// compare tells if a difference satisfies an operator
+func compare(op string, difference int64) bool {
+	switch op {
+	case "<":
+		return difference < 0
+	case "<=":
+		return difference <= 0
+	case ">":
+		return difference > 0
+	case ">=":
+		return difference >= 0
+	}
+	return difference == 0
+}
+
+// is tells if the todo is in a state of is:
+func (t *Todo) is(state string, env *queryEnv) bool {
+	switch state {
+	case "overdue":
+		return t.IsOverdue(env.now)
+	case "today":
+		return t.IsDueToday(env.now)
+	case "finished":
+		return t.IsFinished()
+	case "recurring":
+		return t.Recur != nil
+	case "blocked":
+		return len(env.blockers[t.ID]) > 0
+	case "subtask":
+		return t.Parent != 0
+	}
+	return false
+}
+
+// notesContain tells if a note of the todo contains a text in lower case
+func (t *Todo) notesContain(text string) bool {
+	for _, note := range t.Notes {
+		if strings.Contains(strings.ToLower(note.Text), text) {
+			return true
+		}
+	}
+	return false
+}
+
+// aboutStatus tells if a query selects todos by their status, then the
+// finished todos are not hidden
+func aboutStatus(q Query) bool {
+	switch q := q.(type) {
+	case andQuery:
+		return anyAboutStatus(q)
+	case orQuery:
+		return anyAboutStatus(q)
+	case notQuery:
+		return aboutStatus(q.Query)
+	case fieldQuery:
+		return q.field == "status" || q.field == "completed" || (q.field == "is" && q.value == "finished")
+	}
+	return false
+}
+
+func anyAboutStatus(terms []Query) bool {
+	for _, term := range terms {
+		if aboutStatus(term) {
+			return true
+		}
+	}
+	return false
+}
+
+// Query keep only the todos matching a query. The text terms match the notes
+// of the todos too when notes is set.
+func (c *Collection) Query(q Query, notes bool) error {
+	matching, err := c.Matching(q, notes)
+	if err != nil {
+		return err
+	}
+	var highlighted Matcher
+	if texts := queryTexts(q); len(texts) > 0 {
+		highlighted, _ = NewMatcher(SearchRegex, strings.Join(texts, "|"))
+	}
+	c.Todos = matching
+	for _, todo := range c.Todos {
+		if highlighted != nil {
+			todo.matched, _ = highlighted.Match(todo.Desc)
+		}
+	}
+	return nil
+}
+
+// Matching returns the todos matching a query, in their order, without
+// removing the others
+func (c *Collection) Matching(q Query, notes bool) ([]*Todo, error) {
+	blockers, err := c.Blockers()
+	if err != nil {
+		return nil, err
+	}
+	env := &queryEnv{now: c.now(), blockers: blockers, notes: notes}
+	matching := []*Todo{}
+	for _, todo := range c.Todos {
+		if q.match(todo, env) {
+			matching = append(matching, todo)
+		}
+	}
+	return matching, nil
+}
+
+// filterText returns a text the todos matching a query must contain, to be
+// searched by the store, when the query is only made of text terms. The store
+// ignores the case of ASCII letters only, so a text with other letters is
+// left to the query.
+func filterText(q Query) string {
+	terms := []Query{q}
+	if and, ok := q.(andQuery); ok {
+		terms = and
+	}
+	var longest string
+	for _, term := range terms {
+		text, ok := term.(textQuery)
+		if !ok {
+			return ""
+		}
+		if len(text) > len(longest) {
+			longest = string(text)
+		}
+	}
+	for _, r := range longest {
+		if r > unicode.MaxASCII {
+			return ""
+		}
+	}
+	return longest
+}
+
+// queryTexts returns the texts a query searches in the descriptions, as
+// regular expressions, but the ones negated
+func queryTexts(q Query) []string {
+	var texts []string
+	switch q := q.(type) {
+	case andQuery:
+		for _, term := range q {
+			texts = append(texts, queryTexts(term)...)
+		}
+	case orQuery:
+		for _, term := range q {
+			texts = append(texts, queryTexts(term)...)
+		}
+	case textQuery:
+		texts = append(texts, regexp.QuoteMeta(string(q)))
+	case fieldQuery:
+		if q.field == "text" {
+			texts = append(texts, regexp.QuoteMeta(q.value))
+		}
+	}
+	return texts
+}
@@ -0,0 +1,245 @@
+package main
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+var queryNow = time.Date(2018, 6, 1, 10, 0, 0, 0, time.Local)
+
+func TestParseQuery(t *testing.T) {
+	tests := []struct {
+		query    string
+		expected string
+	}{
+		{"", "(all)"},
+		{"   ", "(all)"},
+		{"bug", `"bug"`},
+		{"Login Bug", `(and "login" "bug")`},
+		{`"login bug"`, `"login bug"`},
+		{`"say \"hi\""`, `"say \"hi\""`},
+		{`"a \\ b"`, `"a \\ b"`},
+		{"status:wip", "status:wip"},
+		{"status=WIP", "status:wip"},
+		{"tag:#API", "tag:api"},
+		{"project:+Web", "project:web"},
+		{`tag:"needs review"`, `tag:"needs review"`},
+		{"uid:3F2A", "uid:3f2a"},
+		{"id>=3", "id>=3"},
+		{"priority>b", "priority>b"},
+		{"priority:high", "priority:high"},
+		{"priority:none", "priority:none"},
+		{"due<2018-07-01", "due<2018-07-01"},
+		{"due<=tomorrow", "due<=tomorrow"},
+		{"due:none", "due:none"},
+		{"created>=+1w modified<today completed:yesterday", "(and created>=+1w modified<today completed:yesterday)"},
+		{"text:api note:call", "(and text:api note:call)"},
+		{"is:overdue", "is:overdue"},
+		{"-tag:later", "(not tag:later)"},
+		{"NOT tag:later", "(not tag:later)"},
+		{`-"login bug"`, `(not "login bug")`},
+		{"- -x", `(and "-" (not "x"))`},
+		{"--x", `"--x"`},
+		{"e-mail", `"e-mail"`},
+		{"12:30", `"12:30"`},
+		{"NOT -a", `(not (not "a"))`},
+		{"a b c", `(and "a" "b" "c")`},
+		{"a AND b", `(and "a" "b")`},
+		{"a OR b", `(or "a" "b")`},
+		{"a or b", `(and "a" "or" "b")`},
+		{"a OR b c", `(or "a" (and "b" "c"))`},
+		{"a b OR c", `(or (and "a" "b") "c")`},
+		{"a OR b OR c", `(or "a" "b" "c")`},
+		{"(a OR b) c", `(and (or "a" "b") "c")`},
+		{"-(a OR b)", `(not (or "a" "b"))`},
+		{"((a))", `"a"`},
+		{"(a)(b)", `(and "a" "b")`},
+		{`status:wip tag:api due<2026-11-01 "login bug" -tag:later`, `(and status:wip tag:api due<2026-11-01 "login bug" (not tag:later))`},
+	}
+	for _, test := range tests {
+		q, err := ParseQuery(test.query, queryNow)
+		if err != nil {
+			t.Errorf("%s: %s", test.query, err)
+			continue
+		}
+		if q.String() != test.expected {
+			t.Errorf("%s: expected %s, got %s", test.query, test.expected, q)
+		}
+	}
+}
+
+func TestParseQueryErrors(t *testing.T) {
+	tests := []struct {
+		query   string
+		column  int
+		message string
+	}{
+		{`"login bug`, 1, "quote opened here is never closed"},
+		{`tag:"needs review`, 5, "quote opened here is never closed"},
+		{"(a", 1, "parenthesis opened here is never closed"},
+		{"a (b (c)", 3, "parenthesis opened here is never closed"},
+		{"a)", 2, "closes nothing"},
+		{")", 1, "a term is expected"},
+		{"()", 2, "parentheses are empty"},
+		{"OR a", 1, "OR must follow a term"},
+		{"AND a", 1, "AND must follow a term"},
+		{"a OR", 5, "OR must be followed by a term"},
+		{"a AND", 6, "AND must be followed by a term"},
+		{"a OR OR b", 6, "OR must be followed by a term"},
+		{"a AND OR b", 7, "AND must be followed by a term"},
+		{"NOT", 4, "NOT must be followed by a term"},
+		{"a NOT)", 6, "NOT must be followed by a term"},
+		{"(a OR)", 6, "OR must be followed by a term"},
+		{"foo:bar", 1, "foo is not a field"},
+		{"a http://x", 3, "http is not a field"},
+		{"tag<x", 4, "tag can't be compared with <"},
+		{"status>=wip", 7, "status can't be compared with >="},
+		{"text>a", 5, "text can't be compared with >"},
+		{"tag:", 5, "tag: needs a value"},
+		{`tag:""`, 6, "tag: needs a value"},
+		{"is:late", 4, "is:late is unknown"},
+		{"id:x", 4, `"x" is not an id`},
+		{"priority:Z", 10, `"Z" is not a priority`},
+		{"priority<none", 10, `"none" is not a priority`},
+		{"due<never", 5, `"never" is not a date`},
+		{"due>none", 5, `"none" is not a date`},
+		{"é due:x", 7, `"x" is not a date`},
+	}
+	for _, test := range tests {
+		_, err := ParseQuery(test.query, queryNow)
+		queryErr, ok := err.(*QueryError)
+		if !ok {
+			t.Errorf("%s: expected a query error, got %v", test.query, err)
+			continue
+		}
+		if queryErr.Column != test.column || !strings.Contains(queryErr.Message, test.message) {
+			t.Errorf("%s: expected \"%s\" at column %d, got \"%s\" at column %d", test.query, test.message, test.column, queryErr.Message, queryErr.Column)
+		}
+	}
+}
+
+func TestQueryErrorDetail(t *testing.T) {
+	_, err := ParseQuery("status:wip (tag:x", queryNow)
+	expected := "Invalid query at column 12: the parenthesis opened here is never closed.\n" +
+		"  status:wip (tag:x\n" +
+		"             ^"
+	if detail := err.(*QueryError).Detail(); detail != expected {
+		t.Errorf("Expected the column to be pointed:\n%s\ngot:\n%s", expected, detail)
+	}
+}
+
+func queryCollection() *Collection {
+	collection := &Collection{Now: func() time.Time { return queryNow }}
+	for _, desc := range []string{"Fix the login bug #api +web", "Write the docs #later", "Deploy +web #api", "Call mum"} {
+		task := NewTodo()
+		task.Desc = desc
+		collection.CreateTodo(task)
+	}
+	collection.SetStatus(1, WIP)
+	collection.SetPriority(1, "A")
+	collection.SetPriority(3, "C")
+	collection.SetDue(3, queryNow.AddDate(0, 0, -1))
+	collection.SetDue(2, queryNow.AddDate(0, 1, 0))
+	collection.SetStatus(4, DONE)
+	collection.AddNote(4, "about the api")
+	collection.Block(3, []int64{1})
+	return collection
+}
+
+func TestQueryMatch(t *testing.T) {
+	tests := []struct {
+		query    string
+		expected []int64
+	}{
+		{"", []int64{1, 2, 3, 4}},
+		{"status:wip", []int64{1}},
+		{"tag:api", []int64{1, 3}},
+		{"tag:api -status:wip", []int64{3}},
+		{"project:web", []int64{1, 3}},
+		{"LOGIN", []int64{1}},
+		{`"the login"`, []int64{1}},
+		{"the", []int64{1, 2}},
+		{"note:api", []int64{4}},
+		{"text:mum", []int64{4}},
+		{"tag:later OR status:done", []int64{2, 4}},
+		{"NOT (tag:api OR tag:later)", []int64{4}},
+		{"priority:a", []int64{1}},
+		{"priority>=c", []int64{1, 3}},
+		{"priority<c", []int64{2, 4}},
+		{"priority:none", []int64{2, 4}},
+		{"due<today", []int64{3}},
+		{"due>=today", []int64{2}},
+		{"due:none", []int64{1, 4}},
+		{"due:yesterday", []int64{3}},
+		{"completed:today", []int64{4}},
+		{"created:today", []int64{1, 2, 3, 4}},
+		{"id>2", []int64{3, 4}},
+		{"id:2", []int64{2}},
+		{"is:overdue", []int64{3}},
+		{"is:finished", []int64{4}},
+		{"is:blocked", []int64{3}},
+		{"is:subtask OR is:recurring", nil},
+	}
+	for _, test := range tests {
+		q, err := ParseQuery(test.query, queryNow)
+		if err != nil {
+			t.Errorf("%s: %s", test.query, err)
+			continue
+		}
+		collection := queryCollection()
+		if err := collection.Query(q, false); err != nil {
+			t.Fatal(err)
+		}
+		var ids []int64
+		for _, todo := range collection.Todos {
+			ids = append(ids, todo.ID)
+		}
+		if joinIDs(ids) != joinIDs(test.expected) {
+			t.Errorf("%s: expected the todos %s, got %s", test.query, joinIDs(test.expected), joinIDs(ids))
+		}
+	}
+}
+
+func TestQueryNotes(t *testing.T) {
+	q, _ := ParseQuery("api", queryNow)
+	collection := queryCollection()
+	collection.Query(q, true)
+	if len(collection.Todos) != 3 || collection.Todos[2].ID != 4 {
+		t.Errorf("Expected the text to match the notes too, got %d todos", len(collection.Todos))
+	}
+}
+
+func TestAboutStatus(t *testing.T) {
+	for query, expected := range map[string]bool{
+		"tag:api":                    false,
+		"status:done":                true,
+		"-status:wip":                true,
+		"bug OR (tag:x is:finished)": true,
+		"is:overdue":                 false,
+		"completed>=yesterday":       true,
+	} {
+		q, _ := ParseQuery(query, queryNow)
+		if aboutStatus(q) != expected {
+			t.Errorf("%s: expected the query to be about the status: %v", query, expected)
+		}
+	}
+}
+
+func TestFilterText(t *testing.T) {
+	for query, expected := range map[string]string{
+		"bug":             "bug",
+		"login bug":       "login",
+		`"the login" bug`: "the login",
+		"bug tag:api":     "",
+		"bug OR api":      "",
+		"-bug":            "",
+		"café":            "",
+		"":                "",
+	} {
+		q, _ := ParseQuery(query, queryNow)
+		if text := filterText(q); text != expected {
+			t.Errorf("%s: expected the store to search \"%s\", got \"%s\"", query, expected, text)
+		}
+	}
+}
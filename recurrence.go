@@ -0,0 +1,208 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Units of a recurrence
+const (
+	Daily   = "day"
+	Weekly  = "week"
+	Monthly = "month"
+)
+
+// Recurrence is the rule of a todo coming back once done
+type Recurrence struct {
+	// Interval is the number of units between two occurrences
+	Interval int    `json:"interval"`
+	Unit     string `json:"unit"`
+	// Weekdays of a weekly recurrence, like "mon" and "thu"
+	Weekdays []string `json:"weekdays,omitempty"`
+	// Day of the month of a monthly recurrence, the last day of the shorter months
+	Day int `json:"day,omitempty"`
+	// After schedules the next occurrence from the completion of the todo
+	// instead of its due date
+	After bool `json:"after,omitempty"`
+}
+
+// ParseRecurrence reads a recurrence rule: "daily", "weekly", "monthly",
+// weekdays ("mon,thu"), or every N days, weeks or months ("3d", "2w", "1m").
+// With the prefix "after", the next occurrence is due after the completion
+// of the todo rather than on the fixed schedule of its due dates.
+func ParseRecurrence(value string) (*Recurrence, error) {
+	value = strings.ToLower(strings.TrimSpace(value))
+	rule := &Recurrence{Interval: 1}
+	if strings.HasPrefix(value, "after ") {
+		rule.After = true
+		value = strings.TrimSpace(strings.TrimPrefix(value, "after "))
+	}
+
+	switch value {
+	case "daily":
+		rule.Unit = Daily
+		return rule, nil
+	case "weekly":
+		rule.Unit = Weekly
+		return rule, nil
+	case "monthly":
+		rule.Unit = Monthly
+		return rule, nil
+	}
+
+	if days, ok := parseWeekdays(value); ok {
+		rule.Unit = Weekly
+		rule.Weekdays = days
+		return rule, nil
+	}
+
+	value = strings.TrimPrefix(value, "+")
+	if len(value) > 1 {
+		count, err := strconv.Atoi(value[:len(value)-1])
+		if err == nil && count > 0 {
+			rule.Interval = count
+			switch value[len(value)-1] {
+			case 'd':
+				rule.Unit = Daily
+				return rule, nil
+			case 'w':
+				rule.Unit = Weekly
+				return rule, nil
+			case 'm':
+				rule.Unit = Monthly
+				return rule, nil
+			}
+		}
+	}
+
+	return nil, fmt.Errorf("\"%s\" is not a recurrence: use daily, weekly, monthly, weekdays like mon,thu, or 3d, 2w, 1m, optionally after \"after\"", value)
+}
+
+// parseWeekdays reads a comma separated list of weekdays, sorted from monday
+func parseWeekdays(value string) ([]string, bool) {
+	seen := map[time.Weekday]bool{}
+	for _, name := range strings.Split(value, ",") {
+		weekday, ok := weekdays[strings.TrimSpace(name)]
+		if !ok {
+			return nil, false
+		}
+		seen[weekday] = true
+	}
+
+	var days []string
+	for weekday := range seen {
+		days = append(days, weekdayName(weekday))
+	}
+	sort.Slice(days, func(i, j int) bool {
+		return (weekdays[days[i]]+6)%7 < (weekdays[days[j]]+6)%7
+	})
+	return days, true
+}
+
+// weekdayName returns the short name of a weekday, like "mon"
+func weekdayName(weekday time.Weekday) string {
+	return strings.ToLower(weekday.String()[:3])
+}
+
+// First returns the first due date of the recurrence from a day: the day
+// itself, or the next of its weekdays
+func (r *Recurrence) First(from time.Time) time.Time {
+	from = day(from)
+	if len(r.Weekdays) > 0 && !r.onWeekday(from) {
+		return r.after(from)
+	}
+	return from
+}
+
+// Next returns the due date of the occurrence following a todo due on due
+// and completed on completed. On a fixed schedule, the occurrences missed
+// before the completion are skipped.
+func (r *Recurrence) Next(due time.Time, completed time.Time) time.Time {
+	completed = day(completed)
+	if r.After || due.IsZero() {
+		return r.after(completed)
+	}
+
+	next := r.after(day(due))
+	for !next.After(completed) {
+		next = r.after(next)
+	}
+	return next
+}
+
+// after returns the occurrence following the day from
+func (r *Recurrence) after(from time.Time) time.Time {
+	switch {
+	case len(r.Weekdays) > 0:
+		next := from.AddDate(0, 0, 1)
+		for !r.onWeekday(next) {
+			next = next.AddDate(0, 0, 1)
+		}
+		return next
+	case r.Unit == Weekly:
+		return from.AddDate(0, 0, 7*r.Interval)
+	case r.Unit == Monthly:
+		dayOfMonth := r.Day
+		if dayOfMonth == 0 {
+			dayOfMonth = from.Day()
+		}
+		// the day 0 of the month after is the last day of the month
+		last := time.Date(from.Year(), from.Month()+time.Month(r.Interval)+1, 0, 0, 0, 0, 0, from.Location())
+		if dayOfMonth > last.Day() {
+			return last
+		}
+		return time.Date(last.Year(), last.Month(), dayOfMonth, 0, 0, 0, 0, from.Location())
+	default:
+		return from.AddDate(0, 0, r.Interval)
+	}
+}
+
+func (r *Recurrence) onWeekday(date time.Time) bool {
+	name := weekdayName(date.Weekday())
+	for _, weekday := range r.Weekdays {
+		if weekday == name {
+			return true
+		}
+	}
+	return false
+}
+
+// String describes the recurrence, like "every 2 weeks"
+func (r *Recurrence) String() string {
+	var text string
+	switch {
+	case len(r.Weekdays) > 0:
+		text = "every " + strings.Join(r.Weekdays, ",")
+	case r.Interval == 1:
+		text = "every " + r.Unit
+	default:
+		text = fmt.Sprintf("every %d %ss", r.Interval, r.Unit)
+	}
+	if r.After {
+		text += " after completion"
+	}
+	return text
+}
+
+// recur adds the next occurrence of a recurring todo just done. The
+// recurrence moves to the new todo, which is returned.
+func (c *Collection) recur(todo *Todo) (*Todo, error) {
+	if todo.Recur == nil {
+		return nil, nil
+	}
+
+	next := NewTodo()
+	next.Desc = todo.Desc
+	next.Priority = todo.Priority
+	next.Parent = todo.Parent
+	next.Recur = todo.Recur
+	next.Due = next.Recur.Next(todo.Due, todo.Completed)
+	if _, err := c.CreateTodo(next); err != nil {
+		return nil, err
+	}
+	todo.Recur = nil
+	return next, nil
+}
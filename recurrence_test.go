@@ -0,0 +1,200 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func utcDay(year int, month time.Month, dayOfMonth int) time.Time {
+	return time.Date(year, month, dayOfMonth, 0, 0, 0, 0, time.UTC)
+}
+
+func TestParseRecurrence(t *testing.T) {
+	cases := map[string]string{
+		"daily":         "every day",
+		"Weekly":        "every week",
+		"monthly":       "every month",
+		"3d":            "every 3 days",
+		"+2w":           "every 2 weeks",
+		"6m":            "every 6 months",
+		"thu,mon":       "every mon,thu",
+		"sun, monday":   "every mon,sun",
+		"after 2w":      "every 2 weeks after completion",
+		"after fri,mon": "every mon,fri after completion",
+	}
+	for value, expected := range cases {
+		rule, err := ParseRecurrence(value)
+		if err != nil {
+			t.Errorf("Expected \"%s\" to be read, got %s", value, err)
+			continue
+		}
+		if rule.String() != expected {
+			t.Errorf("Expected \"%s\" to be read as \"%s\", got \"%s\"", value, expected, rule)
+		}
+	}
+
+	for _, value := range []string{"", "often", "0d", "-1w", "3y", "mon,often", "after"} {
+		if _, err := ParseRecurrence(value); err == nil {
+			t.Errorf("Expected \"%s\" to be refused", value)
+		}
+	}
+}
+
+func TestNextOccurrence(t *testing.T) {
+	cases := []struct {
+		rule      string
+		due       time.Time
+		completed time.Time
+		expected  time.Time
+	}{
+		// 2018-05-25 is a friday
+		{"daily", utcDay(2018, 5, 25), utcDay(2018, 5, 25), utcDay(2018, 5, 26)},
+		{"3d", utcDay(2018, 5, 25), utcDay(2018, 5, 25), utcDay(2018, 5, 28)},
+		{"2w", utcDay(2018, 5, 25), utcDay(2018, 5, 24), utcDay(2018, 6, 8)},
+		{"mon,thu", utcDay(2018, 5, 24), utcDay(2018, 5, 24), utcDay(2018, 5, 28)},
+		{"mon,thu", utcDay(2018, 5, 28), utcDay(2018, 5, 28), utcDay(2018, 5, 31)},
+		// a fixed schedule skips the occurrences missed before the completion
+		{"daily", utcDay(2018, 5, 20), utcDay(2018, 5, 25), utcDay(2018, 5, 26)},
+		{"weekly", utcDay(2018, 5, 4), utcDay(2018, 5, 25), utcDay(2018, 6, 1)},
+		// after completion, the due date doesn't matter
+		{"after 3d", utcDay(2018, 5, 20), utcDay(2018, 5, 25), utcDay(2018, 5, 28)},
+		{"after mon,thu", utcDay(2018, 5, 20), utcDay(2018, 5, 25), utcDay(2018, 5, 28)},
+		// without due date, the schedule starts at the completion
+		{"weekly", time.Time{}, utcDay(2018, 5, 25), utcDay(2018, 6, 1)},
+	}
+	for _, c := range cases {
+		rule, _ := ParseRecurrence(c.rule)
+		if next := rule.Next(c.due, c.completed); !next.Equal(c.expected) {
+			t.Errorf("Expected \"%s\" due %s and done %s to come back on %s, got %s", c.rule,
+				c.due.Format(dateLayout), c.completed.Format(dateLayout), c.expected.Format(dateLayout), next.Format(dateLayout))
+		}
+	}
+}
+
+func TestMonthlyOccurrencesAtMonthEnd(t *testing.T) {
+	rule := &Recurrence{Interval: 1, Unit: Monthly, Day: 31}
+	expected := []time.Time{
+		utcDay(2020, 2, 29),
+		utcDay(2020, 3, 31),
+		utcDay(2020, 4, 30),
+		utcDay(2020, 5, 31),
+	}
+	due := utcDay(2020, 1, 31)
+	for _, next := range expected {
+		if due = rule.Next(due, due); !due.Equal(next) {
+			t.Fatalf("Expected the next occurrence on %s, got %s", next.Format(dateLayout), due.Format(dateLayout))
+		}
+	}
+
+	rule = &Recurrence{Interval: 1, Unit: Monthly, Day: 29}
+	if next := rule.Next(utcDay(2019, 1, 29), utcDay(2019, 1, 29)); !next.Equal(utcDay(2019, 2, 28)) {
+		t.Errorf("Expected the last day of a february out of leap years, got %s", next.Format(dateLayout))
+	}
+	rule = &Recurrence{Interval: 3, Unit: Monthly, Day: 30}
+	if next := rule.Next(utcDay(2018, 11, 30), utcDay(2018, 11, 30)); !next.Equal(utcDay(2019, 2, 28)) {
+		t.Errorf("Expected every 3 months to cross the year, got %s", next.Format(dateLayout))
+	}
+}
+
+func TestOccurrencesAcrossDST(t *testing.T) {
+	paris, err := time.LoadLocation("Europe/Paris")
+	if err != nil {
+		t.Skip("no time zone database", err)
+	}
+	cases := map[string]time.Time{
+		"daily":  time.Date(2018, 3, 25, 0, 0, 0, 0, paris),
+		"weekly": time.Date(2018, 3, 31, 0, 0, 0, 0, paris),
+		"sun":    time.Date(2018, 3, 25, 0, 0, 0, 0, paris),
+	}
+	// summer time starts on 2018-03-25, winter time on 2018-10-28
+	due := time.Date(2018, 3, 24, 0, 0, 0, 0, paris)
+	for value, expected := range cases {
+		rule, _ := ParseRecurrence(value)
+		if next := rule.Next(due, due); !next.Equal(expected) || next.Hour() != 0 {
+			t.Errorf("Expected \"%s\" to come back at midnight on %s, got %s", value, expected, next)
+		}
+	}
+
+	rule, _ := ParseRecurrence("daily")
+	due = time.Date(2018, 10, 27, 0, 0, 0, 0, paris)
+	if next := rule.Next(due, due); next.Day() != 28 || next.Hour() != 0 {
+		t.Errorf("Expected the change to winter time to be the next day at midnight, got %s", next)
+	}
+}
+
+func TestFirstOccurrence(t *testing.T) {
+	rule, _ := ParseRecurrence("mon,thu")
+	if first := rule.First(utcDay(2018, 5, 25)); !first.Equal(utcDay(2018, 5, 28)) {
+		t.Errorf("Expected the first occurrence on the next monday, got %s", first.Format(dateLayout))
+	}
+	if first := rule.First(utcDay(2018, 5, 24)); !first.Equal(utcDay(2018, 5, 24)) {
+		t.Errorf("Expected the first occurrence on the same thursday, got %s", first.Format(dateLayout))
+	}
+	rule, _ = ParseRecurrence("2w")
+	if first := rule.First(utcDay(2018, 5, 25)); !first.Equal(utcDay(2018, 5, 25)) {
+		t.Errorf("Expected the first occurrence today, got %s", first.Format(dateLayout))
+	}
+}
+
+func TestDoneRecurringTodoComesBack(t *testing.T) {
+	collection := Collection{Now: fixedClock()}
+	task := NewTodo()
+	task.Desc = "update dependencies #maintenance +infra"
+	task.Priority = "B"
+	task.Due = utcDay(2018, 5, 24)
+	task.Recur, _ = ParseRecurrence("mon,thu")
+	collection.CreateTodo(task)
+
+	collection.SetStatus(1, WIP)
+	if len(collection.Todos) != 1 {
+		t.Fatal("Expected no occurrence before the todo is done")
+	}
+	collection.SetStatus(1, DONE)
+	if len(collection.Todos) != 2 {
+		t.Fatalf("Expected the next occurrence to be added, got %d todos", len(collection.Todos))
+	}
+
+	next := collection.Todos[1]
+	if next.ID != 2 || next.Status != PENDING || next.Desc != task.Desc || next.Priority != "B" {
+		t.Errorf("Expected a pending copy of the todo, got %+v", next)
+	}
+	if next.Project != "infra" || !next.HasTag("maintenance") {
+		t.Errorf("Expected the copy to keep the tags and project, got %v and \"%s\"", next.Tags, next.Project)
+	}
+	if !next.Due.Equal(utcDay(2018, 5, 28)) {
+		t.Errorf("Expected the next occurrence on monday, got %s", next.Due.Format(dateLayout))
+	}
+	if next.Recur == nil || task.Recur != nil {
+		t.Error("Expected the recurrence to move to the next occurrence")
+	}
+
+	// toggling the done todo back and forth doesn't add another occurrence
+	collection.SetStatus(1, PENDING)
+	collection.SetStatus(1, DONE)
+	if len(collection.Todos) != 2 {
+		t.Errorf("Expected only one next occurrence, got %d todos", len(collection.Todos))
+	}
+}
+
+func TestToggleRecurringTodo(t *testing.T) {
+	collection := Collection{Now: fixedClock()}
+	task := NewTodo()
+	task.Status = WIP
+	task.Recur, _ = ParseRecurrence("after 3d")
+	collection.CreateTodo(task)
+
+	collection.Toggle(1)
+	if len(collection.Todos) != 2 {
+		t.Fatalf("Expected the toggle to done to add the next occurrence, got %d todos", len(collection.Todos))
+	}
+	// completed on 2018-05-25
+	if due := collection.Todos[1].Due; !due.Equal(utcDay(2018, 5, 28)) {
+		t.Errorf("Expected the next occurrence 3 days after the completion, got %s", due.Format(dateLayout))
+	}
+}
+
+func ExampleTodo_MakeOutput_recurring() {
+	todo := Todo{ID: 3, Desc: "Water plants", Status: "pending", Recur: &Recurrence{Interval: 2, Unit: Daily}}
+	todo.MakeOutput(false)
+	// Output: 3 | ✕ Water plants (every 2 days)
+}
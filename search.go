@@ -0,0 +1,222 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+	"unicode/utf8"
+)
+
+// Search modes of td search, besides the queries
+const (
+	SearchRegex = "regex"
+	SearchWord  = "word"
+	SearchFuzzy = "fuzzy"
+)
+
+// Matcher finds a pattern in a text. It returns the parts of the text
+// matched, nil when the pattern is not found, and a score: the higher, the
+// better the match.
+type Matcher interface {
+	Match(text string) (spans [][]int, score float64)
+}
+
+// NewMatcher returns the matcher of a search mode, whatever the case:
+//
+//   - regex: pattern is a RE2 regular expression
+//   - word: pattern is found as whole words, "log" doesn't match "login"
+//   - fuzzy: each word of pattern is found in a word of the text, at its
+//     start, inside it or with up to 2 typos
+func NewMatcher(mode string, pattern string) (Matcher, error) {
+	switch mode {
+	case SearchRegex:
+		// the error is about the pattern given, without the flag
+		if _, err := regexp.Compile(pattern); err != nil {
+			return nil, fmt.Errorf("The pattern is not valid: %s", strings.TrimPrefix(err.Error(), "error parsing regexp: "))
+		}
+		re, err := regexp.Compile("(?i)" + pattern)
+		return regexMatcher{re}, err
+	case SearchWord:
+		if strings.TrimSpace(pattern) == "" {
+			return nil, fmt.Errorf("The pattern has no word to search")
+		}
+		// \b only knows ASCII letters
+		re := regexp.MustCompile(`(?i)(?:^|[^\p{L}\p{N}_])(` + regexp.QuoteMeta(strings.TrimSpace(pattern)) + `)(?:$|[^\p{L}\p{N}_])`)
+		return wordMatcher{re}, nil
+	case SearchFuzzy:
+		words := wordReg.FindAllString(strings.ToLower(pattern), -1)
+		if len(words) == 0 {
+			return nil, fmt.Errorf("The pattern %s has no word to search", pattern)
+		}
+		return fuzzyMatcher(words), nil
+	}
+	return nil, fmt.Errorf("The search mode %s is unknown", mode)
+}
+
+type regexMatcher struct {
+	re *regexp.Regexp
+}
+
+func (m regexMatcher) Match(text string) ([][]int, float64) {
+	spans := m.re.FindAllStringIndex(text, -1)
+	if spans == nil {
+		return nil, 0
+	}
+	return spans, 1
+}
+
+type wordMatcher struct {
+	re *regexp.Regexp
+}
+
+func (m wordMatcher) Match(text string) ([][]int, float64) {
+	var spans [][]int
+	for start := 0; start < len(text); {
+		match := m.re.FindStringSubmatchIndex(text[start:])
+		if match == nil {
+			break
+		}
+		spans = append(spans, []int{start + match[2], start + match[3]})
+		// the next word may start with the character ending this one
+		start += match[3]
+	}
+	if spans == nil {
+		return nil, 0
+	}
+	return spans, 1
+}
+
+var wordReg = regexp.MustCompile(`[\p{L}\p{N}_]+`)
+
+// fuzzyMatcher are the words searched, in lower case
+type fuzzyMatcher []string
+
+// Match scores the best word of the text for each word searched: 1 when it
+// is the same word, 0.9 when it starts or contains it, and less for each typo.
+// The score is the average of the words, which must all be found.
+func (m fuzzyMatcher) Match(text string) ([][]int, float64) {
+	indexes := wordReg.FindAllStringIndex(text, -1)
+	var spans [][]int
+	total := 0.0
+	for _, searched := range m {
+		best, bestIndex := 0.0, -1
+		for i, index := range indexes {
+			if score := wordScore(searched, strings.ToLower(text[index[0]:index[1]])); score > best {
+				best, bestIndex = score, i
+			}
+		}
+		if bestIndex < 0 {
+			return nil, 0
+		}
+		spans = append(spans, indexes[bestIndex])
+		total += best
+	}
+	return mergeSpans(spans), total / float64(len(m))
+}
+
+// wordScore compares a word searched to a word of a text
+func wordScore(searched string, word string) float64 {
+	switch {
+	case searched == word:
+		return 1
+	case strings.Contains(word, searched):
+		return 0.9
+	}
+	// a word with typos can also be searched by its start
+	length := utf8.RuneCountInString(searched)
+	if prefix := []rune(word); len(prefix) > length+1 {
+		word = string(prefix[:length+1])
+	}
+	typos := editDistance(searched, word)
+	if typos > maxTypos(length) {
+		return 0
+	}
+	return 0.8 - 0.2*float64(typos-1)
+}
+
+// maxTypos returns the number of typos accepted in a word of length letters
+func maxTypos(length int) int {
+	switch {
+	case length < 3:
+		return 0
+	case length < 6:
+		return 1
+	}
+	return 2
+}
+
+// editDistance returns the number of letters inserted, deleted, replaced or
+// swapped with the next one to change a into b
+func editDistance(a string, b string) int {
+	ra, rb := []rune(a), []rune(b)
+	rows := make([][]int, len(ra)+1)
+	for i := range rows {
+		rows[i] = make([]int, len(rb)+1)
+		rows[i][0] = i
+	}
+	for j := range rows[0] {
+		rows[0][j] = j
+	}
+	for i := 1; i <= len(ra); i++ {
+		for j := 1; j <= len(rb); j++ {
+			cost := 1
+			if ra[i-1] == rb[j-1] {
+				cost = 0
+			}
+			rows[i][j] = minInt(rows[i-1][j]+1, minInt(rows[i][j-1]+1, rows[i-1][j-1]+cost))
+			if i > 1 && j > 1 && ra[i-1] == rb[j-2] && ra[i-2] == rb[j-1] {
+				rows[i][j] = minInt(rows[i][j], rows[i-2][j-2]+1)
+			}
+		}
+	}
+	return rows[len(ra)][len(rb)]
+}
+
+func minInt(a int, b int) int {
+	if a < b {
+		return a
+	}
+	return b
+}
+
+// mergeSpans sorts spans and merges the overlapping ones
+func mergeSpans(spans [][]int) [][]int {
+	sort.Slice(spans, func(i, j int) bool { return spans[i][0] < spans[j][0] })
+	var merged [][]int
+	for _, span := range spans {
+		if last := len(merged) - 1; last >= 0 && span[0] <= merged[last][1] {
+			if span[1] > merged[last][1] {
+				merged[last][1] = span[1]
+			}
+			continue
+		}
+		merged = append(merged, []int{span[0], span[1]})
+	}
+	return merged
+}
+
+// SearchMatching keep only the todos whose description matches, or one of
+// their notes when notes is set, the best matches first. The parts of the
+// descriptions matched are highlighted by MakeOutput.
+func (c *Collection) SearchMatching(m Matcher, notes bool) {
+	scores := map[*Todo]float64{}
+	for i := len(c.Todos) - 1; i >= 0; i-- {
+		todo := c.Todos[i]
+		spans, score := m.Match(todo.Desc)
+		if notes {
+			for _, note := range todo.Notes {
+				if _, noteScore := m.Match(note.Text); noteScore > score {
+					score = noteScore
+				}
+			}
+		}
+		if score == 0 {
+			c.RemoveAtIndex(i)
+			continue
+		}
+		todo.matched = spans
+		scores[todo] = score
+	}
+	sort.SliceStable(c.Todos, func(i, j int) bool { return scores[c.Todos[i]] > scores[c.Todos[j]] })
+}
@@ -0,0 +1,133 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+// spanTexts returns the parts of a text matched by a pattern
+func spanTexts(t *testing.T, mode string, pattern string, text string) []string {
+	matcher, err := NewMatcher(mode, pattern)
+	if err != nil {
+		t.Fatal(err)
+	}
+	spans, _ := matcher.Match(text)
+	var texts []string
+	for _, span := range spans {
+		texts = append(texts, text[span[0]:span[1]])
+	}
+	return texts
+}
+
+func TestMatchers(t *testing.T) {
+	tests := []struct {
+		mode     string
+		pattern  string
+		text     string
+		expected string
+	}{
+		{SearchRegex, "log(in|out)", "Fix the Login and the logout", "Login,logout"},
+		{SearchRegex, `v\d+\.\d+`, "release v1.2 then v2.0", "v1.2,v2.0"},
+		{SearchRegex, "^fix", "prefix", ""},
+		{SearchWord, "log", "log the login in the log", "log,log"},
+		{SearchWord, "bug", "bug bug,bug", "bug,bug,bug"},
+		{SearchWord, "été", "un été, l'étément", "été"},
+		{SearchWord, "c++", "learn C++ and c+", "C++"},
+		{SearchFuzzy, "lgoin", "Fix the login bug", "login"},
+		{SearchFuzzy, "deploy pgae", "Deploy the login page", "Deploy,page"},
+		{SearchFuzzy, "log", "Fix the login bug", "login"},
+		{SearchFuzzy, "deplyo", "Deployment", "Deployment"},
+		{SearchFuzzy, "bug fix", "fix the bug", "fix,bug"},
+		{SearchFuzzy, "cat", "cut", "cut"},
+		{SearchFuzzy, "cat", "dog", ""},
+		{SearchFuzzy, "it", "at", ""},
+		{SearchFuzzy, "login missing", "Fix the login bug", ""},
+	}
+	for _, test := range tests {
+		got := strings.Join(spanTexts(t, test.mode, test.pattern, test.text), ",")
+		if got != test.expected {
+			t.Errorf("%s %s in %q: expected %q, got %q", test.mode, test.pattern, test.text, test.expected, got)
+		}
+	}
+}
+
+func TestMatcherErrors(t *testing.T) {
+	if _, err := NewMatcher(SearchRegex, "log(in"); err == nil || !strings.Contains(err.Error(), "missing closing )") {
+		t.Errorf("Expected the error of the pattern, got %v", err)
+	}
+	if _, err := NewMatcher(SearchFuzzy, "!?"); err == nil {
+		t.Error("Expected a fuzzy pattern without word to be refused")
+	}
+	if _, err := NewMatcher(SearchWord, " "); err == nil {
+		t.Error("Expected a blank word to be refused")
+	}
+	if _, err := NewMatcher("soundex", "x"); err == nil {
+		t.Error("Expected an unknown mode to be refused")
+	}
+}
+
+func TestEditDistance(t *testing.T) {
+	for _, test := range []struct {
+		a, b     string
+		expected int
+	}{
+		{"login", "login", 0},
+		{"lgoin", "login", 1},
+		{"logn", "login", 1},
+		{"loggin", "login", 1},
+		{"lagin", "login", 1},
+		{"été", "ete", 2},
+		{"", "abc", 3},
+	} {
+		if got := editDistance(test.a, test.b); got != test.expected {
+			t.Errorf("Expected %d typos from %s to %s, got %d", test.expected, test.a, test.b, got)
+		}
+	}
+}
+
+func TestSearchMatchingRanks(t *testing.T) {
+	collection, _ := collectionFromTaskDesk([]string{"Deploy the logn page", "Fix the login bug", "Write docs", "Check the logins"})
+	matcher, _ := NewMatcher(SearchFuzzy, "login")
+	collection.SearchMatching(matcher, false)
+
+	var descs []string
+	for _, todo := range collection.Todos {
+		descs = append(descs, todo.Desc)
+	}
+	expected := "Fix the login bug,Check the logins,Deploy the logn page"
+	if strings.Join(descs, ",") != expected {
+		t.Errorf("Expected the best matches first: %s, got %s", expected, strings.Join(descs, ","))
+	}
+	if span := collection.Todos[0].matched; len(span) != 1 || span[0][0] != 8 || span[0][1] != 13 {
+		t.Errorf("Expected the matched word to be kept for the highlighting, got %v", span)
+	}
+}
+
+func TestSearchMatchingNotes(t *testing.T) {
+	collection := Collection{Now: fixedClock()}
+	for _, desc := range []string{"Call mum", "Call dad"} {
+		task := NewTodo()
+		task.Desc = desc
+		collection.CreateTodo(task)
+	}
+	collection.AddNote(2, "ask about the plumber")
+	matcher, _ := NewMatcher(SearchWord, "plumber")
+
+	collection.SearchMatching(matcher, true)
+	if len(collection.Todos) != 1 || collection.Todos[0].ID != 2 || collection.Todos[0].matched != nil {
+		t.Errorf("Expected only the todo whose note matches, without highlight, got %d todos", len(collection.Todos))
+	}
+}
+
+func TestHighlights(t *testing.T) {
+	desc := "Fix the login bug #login +web"
+	tokens := highlights(desc, [][]int{{8, 13}, {19, 24}})
+	var parts []string
+	for _, token := range tokens {
+		parts = append(parts, desc[token.start:token.end])
+	}
+	// the hashtag overlapped by a match is not colored as a hashtag
+	if strings.Join(parts, ",") != "login,login,+web" {
+		t.Errorf("Expected the matches to replace the hashtag, got %q", parts)
+	}
+}
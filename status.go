@@ -0,0 +1,253 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/daviddengcn/go-colortext"
+	p "github.com/deild/td/printer"
+)
+
+// EnvStatuses environnement variable name for the statuses of the todos, in
+// the order followed by toggle, like "pending,wip,review:R:yellow,done". Each
+// status can be followed by its symbol, its color and "finished" when the
+// todos having it are done.
+const EnvStatuses = "TODO_STATUSES"
+
+// EnvToggle environnement variable name for the statuses followed by toggle,
+// like "pending,done" to skip wip. They keep the order of TODO_STATUSES.
+const EnvToggle = "TODO_TOGGLE"
+
+// Status of a todo, as configured
+type Status struct {
+	Name   string
+	Symbol string
+	Color  ct.Color
+	// Finished is set for the statuses of the todos done, which are hidden
+	// and removed by clean
+	Finished bool
+}
+
+// defaultStatuses are the statuses used when TODO_STATUSES is not set
+var defaultStatuses = []Status{
+	{Name: PENDING, Symbol: p.KoSign, Color: ct.Red},
+	{Name: WIP, Symbol: p.WpSign, Color: ct.Blue},
+	{Name: DONE, Symbol: p.OkSign, Color: ct.Green, Finished: true},
+}
+
+// configuredStatuses are the statuses of the todos, in the order followed by
+// toggle
+var configuredStatuses = defaultStatuses
+
+// toggleCycle are the names of the statuses followed by toggle, all of them
+// when empty
+var toggleCycle map[string]bool
+
+var colorNames = map[string]ct.Color{
+	"black":   ct.Black,
+	"red":     ct.Red,
+	"green":   ct.Green,
+	"yellow":  ct.Yellow,
+	"blue":    ct.Blue,
+	"magenta": ct.Magenta,
+	"cyan":    ct.Cyan,
+	"white":   ct.White,
+}
+
+// LoadStatuses reads the statuses configured by TODO_STATUSES
+func LoadStatuses() error {
+	value := os.Getenv(EnvStatuses)
+	if value == "" {
+		configuredStatuses = defaultStatuses
+		return nil
+	}
+	configured, err := ParseStatuses(value)
+	if err != nil {
+		return fmt.Errorf("%s: %s", EnvStatuses, err)
+	}
+	configuredStatuses = configured
+	return nil
+}
+
+// LoadToggle reads the statuses followed by toggle configured by TODO_TOGGLE,
+// once the statuses are loaded
+func LoadToggle() error {
+	value := os.Getenv(EnvToggle)
+	if value == "" {
+		toggleCycle = nil
+		return nil
+	}
+	cycle, err := ParseToggle(value)
+	if err != nil {
+		return fmt.Errorf("%s: %s", EnvToggle, err)
+	}
+	toggleCycle = cycle
+	return nil
+}
+
+// ParseToggle reads a comma separated list of the statuses followed by
+// toggle, at least two of the configured ones
+func ParseToggle(value string) (map[string]bool, error) {
+	cycle := map[string]bool{}
+	for _, field := range strings.Split(value, ",") {
+		name := strings.ToLower(strings.TrimSpace(field))
+		if !isStatus(name) {
+			return nil, fmt.Errorf("%s is not a status, use one of: %s", name, statusNames())
+		}
+		cycle[name] = true
+	}
+	if len(cycle) < 2 {
+		return nil, fmt.Errorf("\"%s\" must have two statuses at least", value)
+	}
+	return cycle, nil
+}
+
+// ParseStatuses reads a comma separated list of statuses. The symbol and the
+// color of pending, wip and done default to the usual ones, the ones of the
+// other statuses to their initial and to yellow, or green once finished.
+func ParseStatuses(value string) ([]Status, error) {
+	var parsed []Status
+	seen := map[string]bool{}
+	finished := 0
+	for _, field := range strings.Split(value, ",") {
+		parts := strings.Split(strings.TrimSpace(field), ":")
+		name := strings.ToLower(parts[0])
+		if name == "" {
+			return nil, fmt.Errorf("\"%s\" has a status without name", value)
+		}
+		if seen[name] {
+			return nil, fmt.Errorf("the status %s is listed twice", name)
+		}
+		seen[name] = true
+
+		status := Status{Name: name}
+		colored := false
+		for _, part := range parts[1:] {
+			if color, ok := colorNames[strings.ToLower(part)]; ok {
+				status.Color = color
+				colored = true
+			} else if strings.ToLower(part) == "finished" {
+				status.Finished = true
+			} else if part != "" {
+				status.Symbol = part
+			}
+		}
+
+		for _, known := range defaultStatuses {
+			if known.Name == name {
+				if status.Symbol == "" {
+					status.Symbol = known.Symbol
+				}
+				if !colored {
+					status.Color = known.Color
+				}
+				status.Finished = status.Finished || known.Finished
+				colored = true
+			}
+		}
+		if status.Symbol == "" {
+			initial, _ := utf8.DecodeRuneInString(name)
+			status.Symbol = strings.ToUpper(string(initial))
+		}
+		if !colored {
+			status.Color = ct.Yellow
+			if status.Finished {
+				status.Color = ct.Green
+			}
+		}
+		if status.Finished {
+			finished++
+		}
+		parsed = append(parsed, status)
+	}
+
+	if finished == 0 || finished == len(parsed) {
+		return nil, fmt.Errorf("\"%s\" must have finished and unfinished statuses", value)
+	}
+	return parsed, nil
+}
+
+// statusOf returns the status named name. A status found in the file but not
+// configured is printed with a question mark, and is not finished.
+func statusOf(name string) Status {
+	for _, status := range configuredStatuses {
+		if status.Name == name {
+			return status
+		}
+	}
+	return Status{Name: name, Symbol: p.UnknownSign, Color: ct.Magenta}
+}
+
+// isStatus tells if a status is configured
+func isStatus(name string) bool {
+	for _, status := range configuredStatuses {
+		if status.Name == name {
+			return true
+		}
+	}
+	return false
+}
+
+// initialStatus returns the status of a new todo, the first one
+func initialStatus() string {
+	return configuredStatuses[0].Name
+}
+
+// finishedStatuses returns the names of the statuses of the todos done
+func finishedStatuses() []string {
+	var names []string
+	for _, status := range configuredStatuses {
+		if status.Finished {
+			names = append(names, status.Name)
+		}
+	}
+	return names
+}
+
+// statusNames returns the names of the statuses, in their order
+func statusNames() string {
+	names := make([]string, len(configuredStatuses))
+	for i, status := range configuredStatuses {
+		names[i] = status.Name
+	}
+	return strings.Join(names, ", ")
+}
+
+// nextStatus returns the status following name in the configured order
+// among the ones of the toggle cycle, the first one after the last one or an
+// unknown one
+func nextStatus(name string) string {
+	start := len(configuredStatuses) - 1
+	for i, status := range configuredStatuses {
+		if status.Name == name {
+			start = i
+		}
+	}
+	for i := 1; i <= len(configuredStatuses); i++ {
+		next := configuredStatuses[(start+i)%len(configuredStatuses)].Name
+		if toggleCycle == nil || toggleCycle[next] {
+			return next
+		}
+	}
+	return initialStatus()
+}
+
+// requireWIP checks wip is configured, for td wip and --wip
+func requireWIP() error {
+	if !isStatus(WIP) {
+		return fmt.Errorf("The status wip is not in %s, use one of: %s.", EnvStatuses, statusNames())
+	}
+	return nil
+}
+
+// doneStatus returns the status given by td done, the first finished one
+func doneStatus() string {
+	return finishedStatuses()[0]
+}
+
+// IsFinished tells if the todo is done, whatever the name of its status
+func (t *Todo) IsFinished() bool {
+	return statusOf(t.Status).Finished
+}
@@ -0,0 +1,139 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/daviddengcn/go-colortext"
+)
+
+// useStatuses configures the statuses for the duration of a test
+func useStatuses(t *testing.T, value string) {
+	configured, err := ParseStatuses(value)
+	if err != nil {
+		t.Fatal(err)
+	}
+	configuredStatuses = configured
+	t.Cleanup(func() { configuredStatuses = defaultStatuses })
+}
+
+func TestParseStatuses(t *testing.T) {
+	parsed, err := ParseStatuses("pending, wip, review:R:cyan, blocked:!, done, dropped:finished")
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []Status{
+		defaultStatuses[0],
+		defaultStatuses[1],
+		{Name: "review", Symbol: "R", Color: ct.Cyan},
+		{Name: "blocked", Symbol: "!", Color: ct.Yellow},
+		defaultStatuses[2],
+		{Name: "dropped", Symbol: "D", Color: ct.Green, Finished: true},
+	}
+	if len(parsed) != len(expected) {
+		t.Fatalf("Expected %d statuses, got %+v", len(expected), parsed)
+	}
+	for i := range expected {
+		if parsed[i] != expected[i] {
+			t.Errorf("Expected %+v, got %+v", expected[i], parsed[i])
+		}
+	}
+
+	for _, value := range []string{"pending,,done", "todo,todo,done", "pending,wip", "done,dropped:finished"} {
+		if _, err := ParseStatuses(value); err == nil {
+			t.Errorf("Expected \"%s\" to be refused", value)
+		}
+	}
+}
+
+func TestToggleFollowsStatuses(t *testing.T) {
+	useStatuses(t, "todo,doing,review,done")
+	collection := Collection{Now: fixedClock()}
+	task := NewTodo()
+	collection.CreateTodo(task)
+	if task.Status != "todo" {
+		t.Fatalf("Expected a new todo to have the first status, got %s", task.Status)
+	}
+
+	for _, expected := range []string{"doing", "review", "done", "todo"} {
+		collection.Toggle(task.ID)
+		if task.Status != expected {
+			t.Errorf("Expected the toggle to go to %s, got %s", expected, task.Status)
+		}
+	}
+}
+
+func TestToggleCycle(t *testing.T) {
+	useStatuses(t, "pending,wip,review,done")
+	cycle, err := ParseToggle("Pending, done")
+	if err != nil {
+		t.Fatal(err)
+	}
+	toggleCycle = cycle
+	t.Cleanup(func() { toggleCycle = nil })
+
+	for status, expected := range map[string]string{
+		PENDING:   DONE,
+		DONE:      PENDING,
+		WIP:       DONE,
+		"review":  DONE,
+		"blocked": PENDING,
+	} {
+		if next := nextStatus(status); next != expected {
+			t.Errorf("Expected %s to be toggled to %s, got %s", status, expected, next)
+		}
+	}
+
+	for _, value := range []string{"done", "pending,closed", "done,done"} {
+		if _, err := ParseToggle(value); err == nil {
+			t.Errorf("Expected \"%s\" to be refused", value)
+		}
+	}
+}
+
+func TestRequireWIP(t *testing.T) {
+	if err := requireWIP(); err != nil {
+		t.Error(err)
+	}
+	useStatuses(t, "todo,doing,done")
+	if err := requireWIP(); err == nil {
+		t.Error("Expected wip to be required when it is not configured")
+	}
+}
+
+func TestSetCustomStatus(t *testing.T) {
+	useStatuses(t, "pending,wip,review,done,dropped:finished")
+	collection := Collection{Now: fixedClock()}
+	task := NewTodo()
+	collection.CreateTodo(task)
+
+	if _, err := collection.SetStatus(task.ID, "blocked"); err == nil {
+		t.Error("Expected an unknown status to be refused")
+	}
+
+	collection.SetStatus(task.ID, WIP)
+	started := task.Started
+	collection.SetStatus(task.ID, "review")
+	if !task.Started.Equal(started) {
+		t.Errorf("Expected the todo to keep the date it was started, got %s", task.Started)
+	}
+
+	collection.SetStatus(task.ID, "dropped")
+	if !task.IsFinished() || task.Completed.IsZero() {
+		t.Error("Expected a todo dropped to be finished")
+	}
+	collection.ListUndoneTodos()
+	if len(collection.Todos) != 0 {
+		t.Error("Expected a todo dropped to be hidden with the done todos")
+	}
+}
+
+func ExampleTodo_MakeOutput_status() {
+	configuredStatuses, _ = ParseStatuses("pending,review:R,done")
+	defer func() { configuredStatuses = defaultStatuses }()
+
+	(&Todo{ID: 1, Desc: "Review the code", Status: "review"}).MakeOutput(false)
+	(&Todo{ID: 2, Desc: "Left by another setup", Status: "blocked"}).MakeOutput(false)
+	// Output:
+	//      1 | R Review the code
+	//      2 | ? Left by another setup
+}
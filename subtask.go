@@ -0,0 +1,180 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/deild/td/db"
+)
+
+// Progress of the children of a todo
+type Progress struct {
+	Done  int
+	Total int
+}
+
+// TreeNode is a todo with its depth in the tree of subtasks
+type TreeNode struct {
+	Todo  *Todo
+	Depth int
+}
+
+// Children returns the direct subtasks of a todo
+func (c *Collection) Children(id int64) []*Todo {
+	var children []*Todo
+	for _, todo := range c.Todos {
+		if todo.Parent == id && todo.ID != id {
+			children = append(children, todo)
+		}
+	}
+	return children
+}
+
+// Descendants returns the subtasks of a todo and their own subtasks
+func (c *Collection) Descendants(id int64) []*Todo {
+	var descendants []*Todo
+	seen := map[int64]bool{id: true}
+	queue := []int64{id}
+	for len(queue) > 0 {
+		for _, child := range c.Children(queue[0]) {
+			if !seen[child.ID] {
+				seen[child.ID] = true
+				descendants = append(descendants, child)
+				queue = append(queue, child.ID)
+			}
+		}
+		queue = queue[1:]
+	}
+	return descendants
+}
+
+// Progress returns, for each todo having subtasks, how many of its direct
+// subtasks are done. When the collection holds only a selection of the todos,
+// the subtasks are queried from the store.
+func (c *Collection) Progress() (map[int64]Progress, error) {
+	todos := c.Todos
+	if querier, ok := c.store.(db.Querier); ok && c.partial {
+		ids := make([]int64, len(c.Todos))
+		for i, todo := range c.Todos {
+			ids[i] = todo.ID
+		}
+		children, err := c.query(querier, db.Filter{Parents: ids})
+		if err != nil {
+			return nil, err
+		}
+		todos = children
+	}
+
+	progress := map[int64]Progress{}
+	for _, todo := range todos {
+		if todo.Parent == 0 || todo.Parent == todo.ID {
+			continue
+		}
+		p := progress[todo.Parent]
+		p.Total++
+		if todo.IsFinished() {
+			p.Done++
+		}
+		progress[todo.Parent] = p
+	}
+	return progress, nil
+}
+
+// Tree returns the todos with their subtasks right after them, keeping the
+// order of the collection among siblings. A todo whose parent is not in the
+// collection is shown at the top level.
+func (c *Collection) Tree() []TreeNode {
+	present := map[int64]bool{}
+	for _, todo := range c.Todos {
+		present[todo.ID] = true
+	}
+
+	var nodes []TreeNode
+	visited := map[*Todo]bool{}
+	var walk func(todo *Todo, depth int)
+	walk = func(todo *Todo, depth int) {
+		if visited[todo] {
+			return
+		}
+		visited[todo] = true
+		nodes = append(nodes, TreeNode{todo, depth})
+		for _, child := range c.Children(todo.ID) {
+			walk(child, depth+1)
+		}
+	}
+
+	for _, todo := range c.Todos {
+		if todo.Parent == 0 || !present[todo.Parent] {
+			walk(todo, 0)
+		}
+	}
+	// todos caught in a cycle of parents have no root
+	for _, todo := range c.Todos {
+		walk(todo, 0)
+	}
+	return nodes
+}
+
+// checkParent verifies that the parent of a todo exists
+func (c *Collection) checkParent(todo *Todo) error {
+	if todo.Parent == 0 {
+		return nil
+	}
+	if _, err := c.Find(todo.Parent); err != nil {
+		return fmt.Errorf("The parent todo %d was not found.", todo.Parent)
+	}
+	return nil
+}
+
+// hasUnfinishedDescendant tells if a subtask of a todo is not done
+func (c *Collection) hasUnfinishedDescendant(id int64) bool {
+	for _, descendant := range c.Descendants(id) {
+		if !descendant.IsFinished() {
+			return true
+		}
+	}
+	return false
+}
+
+// ids returns the current ID of each todo, to follow the references between
+// todos when they are renumbered
+func (c *Collection) ids() map[*Todo]int64 {
+	ids := make(map[*Todo]int64, len(c.Todos))
+	for _, todo := range c.Todos {
+		ids[todo] = todo.ID
+	}
+	return ids
+}
+
+// renumbered rewrites the references between todos after their IDs changed
+// from old. A reference to a todo no longer in the collection is removed.
+func (c *Collection) renumbered(old map[*Todo]int64) {
+	newIDs := make(map[int64]int64, len(old))
+	var now time.Time
+	for _, todo := range c.Todos {
+		id, ok := old[todo]
+		if !ok {
+			continue
+		}
+		newIDs[id] = todo.ID
+		if id != todo.ID {
+			if now.IsZero() {
+				now = c.now()
+			}
+			c.record(todo, now, EventRenumbered, strconv.FormatInt(id, 10), strconv.FormatInt(todo.ID, 10))
+		}
+	}
+	for _, todo := range c.Todos {
+		if todo.Parent != 0 {
+			todo.Parent = newIDs[todo.Parent]
+		}
+		var dependsOn []int64
+		for _, dependency := range todo.DependsOn {
+			if id, ok := newIDs[dependency]; ok {
+				dependsOn = append(dependsOn, id)
+			}
+		}
+		todo.DependsOn = dependsOn
+	}
+}
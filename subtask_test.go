@@ -0,0 +1,176 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/deild/td/db"
+)
+
+// subtaskCollection holds 1 with the subtasks 2 and 3, 3 with the subtask 4,
+// and 5 alone
+func subtaskCollection() Collection {
+	collection, _ := collectionFromTaskDesk([]string{"Release", "Write changelog", "Build", "Compile", "Call mum"})
+	collection.Todos[1].Parent = 1
+	collection.Todos[2].Parent = 1
+	collection.Todos[3].Parent = 3
+	return collection
+}
+
+func parentOf(t *testing.T, collection Collection, desc string) int64 {
+	for _, todo := range collection.Todos {
+		if todo.Desc == desc {
+			return todo.Parent
+		}
+	}
+	t.Fatalf("The todo \"%s\" was not found", desc)
+	return 0
+}
+
+func TestCreateSubtask(t *testing.T) {
+	collection := subtaskCollection()
+	task := NewTodo()
+	task.Parent = 9
+	if _, err := collection.CreateTodo(task); err == nil {
+		t.Error("Expected a subtask of a missing todo to fail")
+	}
+	task.Parent = 5
+	if _, err := collection.CreateTodo(task); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestDescendants(t *testing.T) {
+	collection := subtaskCollection()
+	if descendants := collection.Descendants(1); len(descendants) != 3 {
+		t.Errorf("Expected 3 descendants of the todo 1, got %d", len(descendants))
+	}
+	if descendants := collection.Descendants(5); len(descendants) != 0 {
+		t.Errorf("Expected no descendant of the todo 5, got %d", len(descendants))
+	}
+}
+
+func TestDoneParentCompletesSubtasks(t *testing.T) {
+	collection := subtaskCollection()
+	collection.SetStatus(1, DONE)
+	for _, todo := range collection.Todos[:4] {
+		if todo.Status != DONE {
+			t.Errorf("Expected the todo %d to be done with its parent, got \"%s\"", todo.ID, todo.Status)
+		}
+	}
+	if collection.Todos[4].Status != PENDING {
+		t.Error("Expected the todo 5 to be left pending")
+	}
+}
+
+func TestCleanKeepsParentOfUnfinishedSubtasks(t *testing.T) {
+	collection := subtaskCollection()
+	collection.SetStatus(1, DONE)
+	collection.SetStatus(4, PENDING)
+	collection.SetStatus(2, DONE)
+	collection.SetStatus(5, DONE)
+	collection.RemoveFinishedTodos()
+
+	var ids []int64
+	for _, todo := range collection.Todos {
+		ids = append(ids, todo.ID)
+	}
+	if len(ids) != 3 || ids[0] != 1 || ids[1] != 3 || ids[2] != 4 {
+		t.Errorf("Expected the todos 1, 3 and 4 to be kept, got %v", ids)
+	}
+}
+
+func TestProgress(t *testing.T) {
+	collection := subtaskCollection()
+	collection.SetStatus(2, DONE)
+	progress, err := collection.Progress()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if progress[1] != (Progress{Done: 1, Total: 2}) {
+		t.Errorf("Expected 1/2 subtasks done for the todo 1, got %+v", progress[1])
+	}
+	if progress[3] != (Progress{Done: 0, Total: 1}) {
+		t.Errorf("Expected 0/1 subtask done for the todo 3, got %+v", progress[3])
+	}
+}
+
+func TestProgressOfSelection(t *testing.T) {
+	store := db.NewSQLiteStore(t.TempDir() + "/" + db.FileName)
+	store.Initialize()
+	full := subtaskCollection()
+	full.store = store
+	full.SetStatus(2, DONE)
+	if err := full.WriteTodos(); err != nil {
+		t.Fatal(err)
+	}
+
+	collection := Collection{store: store}
+	if err := collection.retrieve(&db.Filter{ExcludedStatuses: []string{DONE}}); err != nil {
+		t.Fatal(err)
+	}
+	defer collection.Close()
+	progress, err := collection.Progress()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if progress[1] != (Progress{Done: 1, Total: 2}) {
+		t.Errorf("Expected the done subtasks to be counted, got %+v", progress[1])
+	}
+}
+
+func TestTree(t *testing.T) {
+	collection := subtaskCollection()
+	collection.Todos[0], collection.Todos[4] = collection.Todos[4], collection.Todos[0]
+
+	nodes := collection.Tree()
+	if len(nodes) != 5 {
+		t.Fatalf("Expected 5 nodes, got %d", len(nodes))
+	}
+	if nodes[0].Todo.ID != 5 || nodes[1].Todo.ID != 1 {
+		t.Errorf("Expected the roots to keep their order, got %d and %d", nodes[0].Todo.ID, nodes[1].Todo.ID)
+	}
+	depths := map[int64]int{5: 0, 1: 0, 2: 1, 3: 1, 4: 2}
+	for _, node := range nodes {
+		if node.Depth != depths[node.Todo.ID] {
+			t.Errorf("Expected the todo %d at depth %d, got %d", node.Todo.ID, depths[node.Todo.ID], node.Depth)
+		}
+	}
+}
+
+func TestTreeSurvivesCycles(t *testing.T) {
+	collection := subtaskCollection()
+	collection.Todos[0].Parent = 4
+	if nodes := collection.Tree(); len(nodes) != 5 {
+		t.Errorf("Expected every todo of a cycle to be shown once, got %d nodes", len(nodes))
+	}
+}
+
+func TestRenumberingKeepsParents(t *testing.T) {
+	collection := subtaskCollection()
+	collection.RemoveAtIndex(1)
+	collection.Reorder()
+	if parent := parentOf(t, collection, "Compile"); parent != 2 {
+		t.Errorf("Expected \"Compile\" to follow \"Build\" renumbered 2, got %d", parent)
+	}
+
+	collection = subtaskCollection()
+	collection.Swap(1, 5)
+	if parent := parentOf(t, collection, "Build"); parent != 5 {
+		t.Errorf("Expected \"Build\" to follow \"Release\" swapped to 5, got %d", parent)
+	}
+
+	collection = subtaskCollection()
+	collection.ReorderByIDs([]int64{4, 3})
+	if parent := parentOf(t, collection, "Compile"); parent != 2 {
+		t.Errorf("Expected \"Compile\" to follow \"Build\" reordered 2, got %d", parent)
+	}
+	if parent := parentOf(t, collection, "Build"); parent != 3 {
+		t.Errorf("Expected \"Build\" to follow \"Release\" reordered 3, got %d", parent)
+	}
+}
+
+func ExampleTodo_MakeTreeOutput() {
+	todo := Todo{ID: 12, Desc: "Build", Status: "pending"}
+	todo.MakeTreeOutput(false, 1, Progress{Done: 1, Total: 2}, nil)
+	// Output: 12 |   ✕ Build [1/2]
+}
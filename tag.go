@@ -0,0 +1,57 @@
+package main
+
+import (
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// hashtagReg matches the hashtags of a description: # at the start of a word
+// followed by letters, digits, _, - or /, but not ending with - or /
+var hashtagReg = regexp.MustCompile(`(?:^|\s)(#[\p{L}\p{N}_](?:[\p{L}\p{N}_\-/]*[\p{L}\p{N}_])?)`)
+
+// ParseTags returns the normalized tags of a description: the hashtags in
+// lower case without the leading #, sorted and without duplicates
+func ParseTags(desc string) []string {
+	var tags []string
+	seen := map[string]bool{}
+	for _, match := range hashtagReg.FindAllStringSubmatch(desc, -1) {
+		tag := NormalizeTag(match[1])
+		if !seen[tag] {
+			seen[tag] = true
+			tags = append(tags, tag)
+		}
+	}
+	sort.Strings(tags)
+	return tags
+}
+
+// hashtagIndexes returns the positions of the hashtags of a description
+func hashtagIndexes(desc string) [][]int {
+	var indexes [][]int
+	for _, match := range hashtagReg.FindAllStringSubmatchIndex(desc, -1) {
+		indexes = append(indexes, match[2:4])
+	}
+	return indexes
+}
+
+// NormalizeTag returns a tag as stored in a todo: in lower case, without #
+func NormalizeTag(tag string) string {
+	return strings.ToLower(strings.TrimPrefix(strings.TrimSpace(tag), "#"))
+}
+
+// HasTag tells if the todo has the tag, compared as a whole
+func (t *Todo) HasTag(tag string) bool {
+	tag = NormalizeTag(tag)
+	for _, own := range t.Tags {
+		if own == tag {
+			return true
+		}
+	}
+	return false
+}
+
+// syncTags parses the tags of the description
+func (t *Todo) syncTags() {
+	t.Tags = ParseTags(t.Desc)
+}
@@ -0,0 +1,37 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseTags(t *testing.T) {
+	cases := map[string][]string{
+		"call mum":                          nil,
+		"call #mum":                         {"mum"},
+		"#Work on #api, then #work again":   {"api", "work"},
+		"review #front-end/login. #2018 #":  {"2018", "front-end/login"},
+		"issue #été-2018 and #under_score-": {"under_score", "été-2018"},
+		"no#tag inside words":               nil,
+		"fix issue#12, see page#intro":      nil,
+		"(#paren) #a #b":                    {"a", "b"},
+	}
+	for desc, expected := range cases {
+		if tags := ParseTags(desc); !reflect.DeepEqual(tags, expected) {
+			t.Errorf("Expected the tags of \"%s\" to be %q, got %q", desc, expected, tags)
+		}
+	}
+}
+
+func TestHasTag(t *testing.T) {
+	todo := NewTodo()
+	todo.Desc = "Prepare the #workshop"
+	todo.syncTags()
+
+	if todo.HasTag("work") {
+		t.Error("Expected #work not to match #workshop")
+	}
+	if !todo.HasTag("#WorkShop") {
+		t.Error("Expected #WorkShop to match #workshop")
+	}
+}
@@ -2,9 +2,10 @@ package main
 
 import (
 	"fmt"
-	"regexp"
+	"sort"
 	"strconv"
 	"strings"
+	"time"
 
 	"github.com/daviddengcn/go-colortext"
 	p "github.com/deild/td/printer"
@@ -12,41 +13,72 @@ import (
 
 // Todo todo's structure
 type Todo struct {
-	ID       int64  `json:"id"`
-	Desc     string `json:"desc"`
-	Status   string `json:"status"`
-	Modified string `json:"modified"`
+	ID       int64     `json:"id"`
+	Desc     string    `json:"desc"`
+	Status   string    `json:"status"`
+	Created  time.Time `json:"created,omitzero"`
+	Modified time.Time `json:"modified,omitzero"`
+	// UID identifies the todo whatever its ID, see Resolve
+	UID string `json:"uid,omitempty"`
+	// Started is set when the todo is moved to WIP
+	Started time.Time `json:"started,omitzero"`
+	// Completed is set when the todo is moved to DONE
+	Completed time.Time `json:"completed,omitzero"`
+	// Due is midnight of the day the todo must be done by
+	Due time.Time `json:"due,omitzero"`
+	// Priority from A (the highest) to E, empty for none
+	Priority string `json:"priority,omitempty"`
+	// Tags are the hashtags of Desc, see ParseTags
+	Tags []string `json:"tags,omitempty"`
+	// Project is the first +project of Desc, see ParseProject
+	Project string `json:"project,omitempty"`
+	// Parent is the ID of the todo this one is a subtask of
+	Parent int64 `json:"parent,omitempty"`
+	// DependsOn are the IDs of the todos blocking this one until they are done
+	DependsOn []int64 `json:"depends,omitempty"`
+	// Recur is the rule adding the next occurrence of the todo once done
+	Recur *Recurrence `json:"recur,omitempty"`
+	// Notes are the annotations of the todo, see AddNote
+	Notes []Note `json:"notes,omitempty"`
+	// History are the changes of the todo, from the oldest
+	History []Event `json:"history,omitempty"`
+	// matched are the parts of the description found by a search, which are
+	// highlighted
+	matched [][]int
 }
 
 // NewTodo create a pending todo
 func NewTodo() *Todo {
 	var todo = new(Todo)
-	todo.Status = PENDING
+	todo.Status = initialStatus()
 	return todo
 }
 
+// IsOverdue tells if the todo is not done and its due date has passed
+func (t *Todo) IsOverdue(now time.Time) bool {
+	return !t.Due.IsZero() && !t.IsFinished() && daysBetween(now, t.Due) < 0
+}
+
+// IsDueToday tells if the todo is not done and due today
+func (t *Todo) IsDueToday(now time.Time) bool {
+	return !t.Due.IsZero() && !t.IsFinished() && daysBetween(now, t.Due) == 0
+}
+
 // MakeOutput print todo
 func (t *Todo) MakeOutput(useColor bool) {
-	var symbole string
-	var color ct.Color
-
-	switch t.Status {
-	case DONE:
-		color = ct.Green
-		symbole = p.OkSign
-	case WIP:
-		color = ct.Blue
-		symbole = p.WpSign
-	default:
-		color = ct.Red
-		symbole = p.KoSign
-	}
+	t.MakeTreeOutput(useColor, 0, Progress{}, nil)
+}
 
-	hashtagReg := regexp.MustCompile(`#[^\\s]*`)
+// MakeTreeOutput print todo indented at the depth of a subtask, followed by
+// the progress of its own subtasks when it has some, and by the todos blocking it
+func (t *Todo) MakeTreeOutput(useColor bool, depth int, progress Progress, blockers []int64) {
+	status := statusOf(t.Status)
+	symbole := status.Symbol
+	color := status.Color
 
 	spaceCount := 6 - len(strconv.FormatInt(t.ID, 10))
 
-	fmt.Print(strings.Repeat(" ", spaceCount), t.ID, " | ")
+	fmt.Print(strings.Repeat(" ", spaceCount), t.ID, " | ", strings.Repeat("  ", depth))
 	if useColor {
 		ct.ChangeColor(color, false, ct.None, false)
 	}
@@ -55,17 +87,123 @@ func (t *Todo) MakeOutput(useColor bool) {
 		ct.ResetColor()
 	}
 	fmt.Print(" ")
+	if t.Priority != "" {
+		t.printPriority(useColor)
+	}
 	pos := 0
-	for _, token := range hashtagReg.FindAllStringIndex(t.Desc, -1) {
-		fmt.Print(t.Desc[pos:token[0]])
+	for _, token := range highlights(t.Desc, t.matched) {
+		fmt.Print(t.Desc[pos:token.start])
 		if useColor {
-			ct.ChangeColor(ct.Yellow, false, ct.None, false)
+			ct.ChangeColor(token.color, false, token.background, false)
 		}
-		fmt.Print(t.Desc[token[0]:token[1]])
+		fmt.Print(t.Desc[token.start:token.end])
 		if useColor {
 			ct.ResetColor()
 		}
-		pos = token[1]
+		pos = token.end
+	}
+	fmt.Print(t.Desc[pos:])
+	if progress.Total > 0 {
+		fmt.Printf(" [%d/%d]", progress.Done, progress.Total)
+	}
+	if len(t.Notes) > 0 {
+		fmt.Print(" ", p.NoteSign, len(t.Notes))
+	}
+	if !t.Due.IsZero() && !t.IsFinished() {
+		t.printDue(useColor, time.Now())
+	}
+	if t.Recur != nil && !t.IsFinished() {
+		fmt.Print(" (", t.Recur, ")")
+	}
+	if len(blockers) > 0 {
+		printBlockers(useColor, blockers)
+	}
+	fmt.Println()
+}
+
+// printBlockers print the IDs of the todos blocking a todo, in grey
+func printBlockers(useColor bool, blockers []int64) {
+	fmt.Print(" ")
+	if useColor {
+		ct.ChangeColor(ct.Black, true, ct.None, false)
+	}
+	fmt.Print("(blocked by ", joinIDs(blockers), ")")
+	if useColor {
+		ct.ResetColor()
+	}
+}
+
+// highlight is a colored part of a description
+type highlight struct {
+	start      int
+	end        int
+	color      ct.Color
+	background ct.Color
+}
+
+// highlights returns the hashtags in yellow and the +projects in cyan, in
+// their order in the description. The parts matched by a search are in black
+// on yellow, over the hashtags and +projects.
+func highlights(desc string, matched [][]int) []highlight {
+	var tokens []highlight
+	overlaps := func(index []int) bool {
+		for _, span := range matched {
+			if span[0] < span[1] && index[0] < span[1] && span[0] < index[1] {
+				return true
+			}
+		}
+		return false
+	}
+	for _, span := range matched {
+		if span[0] < span[1] {
+			tokens = append(tokens, highlight{span[0], span[1], ct.Black, ct.Yellow})
+		}
+	}
+	for _, index := range hashtagIndexes(desc) {
+		if !overlaps(index) {
+			tokens = append(tokens, highlight{index[0], index[1], ct.Yellow, ct.None})
+		}
+	}
+	for _, index := range projectIndexes(desc) {
+		if !overlaps(index) {
+			tokens = append(tokens, highlight{index[0], index[1], ct.Cyan, ct.None})
+		}
+	}
+	sort.Slice(tokens, func(i, j int) bool { return tokens[i].start < tokens[j].start })
+	return tokens
+}
+
+// printPriority print the priority before the description, A in red and B in yellow
+func (t *Todo) printPriority(useColor bool) {
+	if useColor {
+		switch t.Priority {
+		case "A":
+			ct.ChangeColor(ct.Red, true, ct.None, false)
+		case "B":
+			ct.ChangeColor(ct.Yellow, true, ct.None, false)
+		}
+	}
+	fmt.Print("(", t.Priority, ")")
+	if useColor {
+		ct.ResetColor()
+	}
+	fmt.Print(" ")
+}
+
+// printDue print the due date relative to now, overdue todos in red and the
+// ones due today in magenta
+func (t *Todo) printDue(useColor bool, now time.Time) {
+	fmt.Print(" ")
+	if useColor {
+		switch {
+		case t.IsOverdue(now):
+			ct.ChangeColor(ct.Red, false, ct.None, false)
+		case t.IsDueToday(now):
+			ct.ChangeColor(ct.Magenta, false, ct.None, false)
+		}
+	}
+	fmt.Print("(", dueText(t.Due, now), ")")
+	if useColor {
+		ct.ResetColor()
 	}
-	fmt.Println(t.Desc[pos:])
 }
@@ -4,10 +4,9 @@ import "testing"
 
 func ExampleTodo() {
 	todo := Todo{
-		ID:       0,
-		Desc:     "Test td",
-		Status:   "pending",
-		Modified: "",
+		ID:     0,
+		Desc:   "Test td",
+		Status: "pending",
 	}
 	todo.MakeOutput(false)
 	// Output: 0 | ✕ Test td
@@ -16,7 +15,6 @@ func TestWithoutColor(t *testing.T) {
 	todo := NewTodo()
 	todo.ID = 0
 	todo.Desc = "Test without color"
-	todo.Modified = ""
 	todo.MakeOutput(false)
 	// Output: 0 | ✕ Test td
 }
@@ -25,7 +23,6 @@ func TestWithColor(t *testing.T) {
 	todo := NewTodo()
 	todo.ID = 0
 	todo.Desc = "Test color"
-	todo.Modified = ""
 	todo.MakeOutput(true)
 	// Output: 0 | ✕ Test td
 }
@@ -43,3 +40,34 @@ func TestStatusDone(t *testing.T) {
 	todo.MakeOutput(false)
 	// Output: 0 | ✕ Test td
 }
+
+func ExampleTodo_priority() {
+	todo := Todo{
+		ID:       3,
+		Desc:     "Test td",
+		Status:   "pending",
+		Priority: "A",
+	}
+	todo.MakeOutput(false)
+	// Output: 3 | ✕ (A) Test td
+}
+
+func ExampleTodo_hashtags() {
+	todo := Todo{
+		ID:     4,
+		Desc:   "Prepare the #workshop, #sweet",
+		Status: "pending",
+	}
+	todo.MakeOutput(false)
+	// Output: 4 | ✕ Prepare the #workshop, #sweet
+}
+
+func ExampleTodo_project() {
+	todo := Todo{
+		ID:     5,
+		Desc:   "Fix the login +api #bug",
+		Status: "wip",
+	}
+	todo.MakeOutput(false)
+	// Output: 5 | • Fix the login +api #bug
+}
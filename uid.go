@@ -0,0 +1,99 @@
+package main
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// minUIDPrefix is the length of the shortest prefix of a UID designating a todo
+const minUIDPrefix = 4
+
+// newUID returns a random identifier, kept by a todo for its whole life
+func newUID() string {
+	uid := make([]byte, 8)
+	if _, err := rand.Read(uid); err != nil {
+		panic(err)
+	}
+	return hex.EncodeToString(uid)
+}
+
+// Resolve returns the ID of the todo designated by ref: its ID, or else its
+// UID or a prefix of it long enough to designate only this todo, like git
+// does with the hashes of the commits
+func (c *Collection) Resolve(ref string) (int64, error) {
+	ref = strings.ToLower(strings.TrimSpace(ref))
+	if id, err := strconv.ParseInt(ref, 10, 32); err == nil {
+		if _, err := c.Find(id); err == nil {
+			return id, nil
+		}
+	}
+
+	var matches []int64
+	if len(ref) >= minUIDPrefix {
+		for _, todo := range c.Todos {
+			if strings.HasPrefix(todo.UID, ref) {
+				matches = append(matches, todo.ID)
+			}
+		}
+	}
+
+	switch len(matches) {
+	case 0:
+		return 0, fmt.Errorf("The todo with the id %s was not found.", ref)
+	case 1:
+		return matches[0], nil
+	default:
+		return 0, fmt.Errorf("The id %s is ambiguous, it starts the UID of the todos %s.", ref, joinIDs(matches))
+	}
+}
+
+// rangeReg matches a range of IDs, like 7-10
+var rangeReg = regexp.MustCompile(`^(\d+)-(\d+)$`)
+
+// ResolveAll returns the IDs of the todos designated by refs, see Resolve,
+// each one once. A range like 7-10 designates the todos from 7 to 10, the
+// IDs no longer used in it are skipped.
+func (c *Collection) ResolveAll(refs []string) ([]int64, error) {
+	var ids []int64
+	seen := map[int64]bool{}
+	add := func(id int64) {
+		if !seen[id] {
+			seen[id] = true
+			ids = append(ids, id)
+		}
+	}
+	for _, ref := range refs {
+		if match := rangeReg.FindStringSubmatch(strings.TrimSpace(ref)); match != nil {
+			first, _ := strconv.ParseInt(match[1], 10, 64)
+			last, _ := strconv.ParseInt(match[2], 10, 64)
+			if first > last {
+				return nil, fmt.Errorf("The range %s is reversed, write %d-%d.", ref, last, first)
+			}
+			var inRange []int64
+			for _, todo := range c.Todos {
+				if todo.ID >= first && todo.ID <= last {
+					inRange = append(inRange, todo.ID)
+				}
+			}
+			if len(inRange) == 0 {
+				return nil, fmt.Errorf("There's no todo in the range %s.", ref)
+			}
+			sort.Slice(inRange, func(i, j int) bool { return inRange[i] < inRange[j] })
+			for _, id := range inRange {
+				add(id)
+			}
+			continue
+		}
+		id, err := c.Resolve(ref)
+		if err != nil {
+			return nil, err
+		}
+		add(id)
+	}
+	return ids, nil
+}
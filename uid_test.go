@@ -0,0 +1,99 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func uidCollection() Collection {
+	collection, _ := collectionFromTaskDesk([]string{"Write", "Test", "Deploy", "Call mum"})
+	collection.Todos[0].UID = "3f2a9c0d1e2b4a5c"
+	collection.Todos[1].UID = "3f2b71aa08c4d9e0"
+	collection.Todos[2].UID = "b81c44e2f0a1d7c3"
+	collection.Todos[3].UID = "1234abcd5678ef90"
+	return collection
+}
+
+func TestCreateTodoGivesUID(t *testing.T) {
+	var collection Collection
+	seen := map[string]bool{}
+	for i := 0; i < 100; i++ {
+		task := NewTodo()
+		collection.CreateTodo(task)
+		if len(task.UID) != 16 || seen[task.UID] {
+			t.Fatalf("Expected a new UID of 16 characters, got \"%s\"", task.UID)
+		}
+		seen[task.UID] = true
+	}
+}
+
+func TestUIDSurvivesRenumbering(t *testing.T) {
+	collection := uidCollection()
+	collection.ReorderByIDs([]int64{3, 1})
+	collection.Swap(2, 4)
+
+	id, err := collection.Resolve("b81c")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if todo, _ := collection.Find(id); todo.Desc != "Deploy" {
+		t.Errorf("Expected the UID to follow \"Deploy\", got \"%s\"", todo.Desc)
+	}
+}
+
+func TestResolve(t *testing.T) {
+	collection := uidCollection()
+	cases := map[string]int64{
+		"2":                2,
+		"3f2a9c0d1e2b4a5c": 1,
+		"3f2b":             2,
+		"B81C44":           3,
+		" b81c ":           3,
+		// digits are matched against the UIDs when no todo has this ID
+		"1234": 4,
+	}
+	for ref, expected := range cases {
+		id, err := collection.Resolve(ref)
+		if err != nil {
+			t.Errorf("Expected \"%s\" to designate the todo %d, got %s", ref, expected, err)
+			continue
+		}
+		if id != expected {
+			t.Errorf("Expected \"%s\" to designate the todo %d, got %d", ref, expected, id)
+		}
+	}
+
+	_, err := collection.Resolve("3f2")
+	if err == nil || !strings.Contains(err.Error(), "not found") {
+		t.Errorf("Expected a prefix shorter than %d characters not to be matched, got %v", minUIDPrefix, err)
+	}
+	_, err = collection.Resolve("3f2a9c0d1e2b4a5cff")
+	if err == nil {
+		t.Error("Expected a reference longer than the UID not to be matched")
+	}
+
+	// an ID comes before a UID
+	collection.Todos[2].ID = 1234
+	if id, _ := collection.Resolve("1234"); id != 1234 {
+		t.Errorf("Expected the ID 1234 to take precedence over the UID prefix, got %d", id)
+	}
+	collection.Todos[0].UID = "3f2b0000aaaabbbb"
+	_, err = collection.Resolve("3f2b")
+	if err == nil || !strings.Contains(err.Error(), "1, 2") {
+		t.Errorf("Expected an ambiguous prefix to list the todos it matches, got %v", err)
+	}
+}
+
+func TestResolveAll(t *testing.T) {
+	collection := uidCollection()
+	ids, err := collection.ResolveAll([]string{"b81c", "1", "3f2b"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if joinIDs(ids) != "3, 1, 2" {
+		t.Errorf("Expected the todos 3, 1 and 2, got %v", ids)
+	}
+	if _, err := collection.ResolveAll([]string{"1", "9"}); err == nil {
+		t.Error("Expected a missing todo to fail")
+	}
+}
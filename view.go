@@ -0,0 +1,87 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/deild/td/db"
+	"github.com/deild/td/helper"
+)
+
+// viewCommands are the subcommands of td view, and "none" which clears the
+// default view, which can't name a view
+var viewCommands = []string{"save", "list", "ls", "rm", "default", "help", "h", "none"}
+
+// Views returns the views saved next to the todos of the collection
+func (c *Collection) Views() (*db.Views, error) {
+	store, err := c.openStore()
+	if err != nil {
+		return nil, err
+	}
+	return db.OpenViews(store)
+}
+
+// EditViews changes the views with edit while the store is locked, without
+// loading the todos
+func (c *Collection) EditViews(edit func(views *db.Views) error) error {
+	store, err := c.openStore()
+	if err != nil {
+		return err
+	}
+	if err = store.Check(); err != nil {
+		return err
+	}
+	if err = store.Lock(); err != nil {
+		return err
+	}
+	defer helper.Check(c.Close)
+
+	views, err := db.OpenViews(store)
+	if err != nil {
+		return err
+	}
+	return edit(views)
+}
+
+// SaveView checks a view and saves it, replacing the view of the same name
+func SaveView(views *db.Views, name string, query string) error {
+	name = strings.TrimSpace(name)
+	if name == "" || strings.ContainsAny(name, " \t\n") {
+		return fmt.Errorf("The name of a view must be a single word, not \"%s\".", name)
+	}
+	for _, command := range viewCommands {
+		if name == command {
+			return fmt.Errorf("%s can't name a view, it is reserved by td view.", name)
+		}
+	}
+	if _, err := ParseQuery(query, time.Now()); err != nil {
+		return queryError(err)
+	}
+	views.Queries[name] = query
+	return views.Save()
+}
+
+// RemoveView removes a view, which is no longer the default one
+func RemoveView(views *db.Views, name string) error {
+	if _, ok := views.Queries[name]; !ok {
+		return fmt.Errorf("There's no view named %s.", name)
+	}
+	delete(views.Queries, name)
+	if views.Default == name {
+		views.Default = ""
+	}
+	return views.Save()
+}
+
+// SetDefaultView sets the view listed by td without arguments, none for the
+// todos not done
+func SetDefaultView(views *db.Views, name string) error {
+	if name == "none" {
+		name = ""
+	} else if _, ok := views.Queries[name]; !ok {
+		return fmt.Errorf("There's no view named %s.", name)
+	}
+	views.Default = name
+	return views.Save()
+}
@@ -0,0 +1,45 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/deild/td/db"
+)
+
+func TestViews(t *testing.T) {
+	store := db.NewMemStore(t.Name())
+	store.Initialize()
+	collection := &Collection{store: store}
+
+	views, err := collection.Views()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := SaveView(views, "standup", "status:wip OR completed:yesterday"); err != nil {
+		t.Fatal(err)
+	}
+	for name, query := range map[string]string{"list": "tag:api", "none": "tag:api", "two words": "tag:api", "": "tag:api", "bad": "tag<api"} {
+		if err := SaveView(views, name, query); err == nil {
+			t.Errorf("Expected the view \"%s\" with the query %s to be refused", name, query)
+		}
+	}
+	if err := SetDefaultView(views, "missing"); err == nil {
+		t.Error("Expected a missing view to be refused as default")
+	}
+	if err := SetDefaultView(views, "standup"); err != nil {
+		t.Fatal(err)
+	}
+
+	views, _ = collection.Views()
+	if len(views.Queries) != 1 || views.Queries["standup"] != "status:wip OR completed:yesterday" || views.Default != "standup" {
+		t.Fatalf("Expected the saved view to be the default one, got %+v", views)
+	}
+
+	if err := RemoveView(views, "standup"); err != nil {
+		t.Fatal(err)
+	}
+	views, _ = collection.Views()
+	if len(views.Queries) != 0 || views.Default != "" {
+		t.Errorf("Expected the default view to be removed, got %+v", views)
+	}
+}